@@ -2,6 +2,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/alecthomas/kong"
@@ -25,12 +26,18 @@ func (v VersionCmd) Run() error {
 }
 
 var cli struct {
-	Version  VersionCmd     `cmd:""        help:"Print version and exit."`
-	Generate cmds.GenCmd    `aliases:"gen" cmd:""                                     help:"Generate GitHub-like tokens."`
-	Disect   cmds.DisectCmd `aliases:"dis" cmd:""                                     help:"Disect GitHub-like tokens."`
-	Login    cmds.LoginCmd  `cmd:""        help:"Test login with one or more tokens."`
-	Local    cmds.LocalCmd  `cmd:""        help:"Perform a local collision test."`
-	IPCheck  cmds.IPCmd     `aliases:"ip"  cmd:""                                     help:"Check resolved public ip address."`
+	Version     VersionCmd          `cmd:""        help:"Print version and exit."`
+	Generate    cmds.GenCmd         `aliases:"gen" cmd:""                                     help:"Generate GitHub-like tokens."`
+	Disect      cmds.DisectCmd      `aliases:"dis" cmd:""                                     help:"Disect GitHub-like tokens."`
+	Login       cmds.LoginCmd       `cmd:""        help:"Test login with one or more tokens."`
+	Local       cmds.LocalCmd       `cmd:""        help:"Perform a local collision test."`
+	Analyze     cmds.AnalyzeCmd     `cmd:"" help:"Analyze a corpus of tokens, optionally comparing it to another."`
+	Odds        cmds.OddsCmd        `cmd:"" help:"Calculate the odds of token collisions."`
+	Experiment  cmds.ExperimentCmd  `cmd:"" help:"Check the odds of token collisions against repeated local collision tests in a reduced keyspace."`
+	Checksum    cmds.ChecksumCmd    `cmd:"" help:"Measure how often corrupted tokens still pass their checksum."`
+	Scan        cmds.ScanCmd        `cmd:"" help:"Scan files and directories for tokens w/ a valid checksum."`
+	InstallHook cmds.InstallHookCmd `cmd:"" help:"Install a git pre-commit hook that blocks commits adding tokens w/ a valid checksum."`
+	IPCheck     cmds.IPCmd          `aliases:"ip"  cmd:""                                     help:"Check resolved public ip address."`
 }
 
 // Main.
@@ -50,5 +57,10 @@ func main() {
 			WrapUpperBound:      120,
 		}))
 	err := ctx.Run()
+	var exit *cmds.ExitError
+	if errors.As(err, &exit) {
+		ctx.Errorf("%s", err)
+		ctx.Exit(exit.ExitCode())
+	}
 	ctx.FatalIfErrorf(err)
 }
@@ -0,0 +1,183 @@
+// Package analysis provides statistics over corpora of tokens, for checking
+// how closely generated tokens resemble real ones.
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pyqlsa/token-forge/pkg/base62"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+// Corpus holds statistics of a set of tokens; only tokens w/ a valid schema
+// are analyzed, as the layout of any other token can't be trusted. Each
+// random segment of a token's input (i.e. each segment, less the checksum of
+// the final segment) is analyzed separately, since each segment is generated
+// separately; segments are grouped by length, and symbols are counted by
+// their value in the token's alphabet, so tokens of different alphabets can
+// be analyzed together.
+type Corpus struct {
+	Tokens   int                   `json:"tokens"`
+	Skipped  int                   `json:"skipped"`
+	Prefixes map[string]int        `json:"prefixes"`
+	Segments map[int]*SegmentStats `json:"segments"`
+}
+
+// SegmentStats holds statistics of every random segment of a given length.
+type SegmentStats struct {
+	Length int `json:"length"`
+	Count  int `json:"count"`
+	// Positions holds, for each position of the segment, the number of times
+	// each symbol value (0-61) appeared at the position.
+	Positions [][base62.AlphabetSize]int `json:"positions"`
+	// LeadingZeros holds the number of segments that began w/ exactly n zero
+	// symbols, at index n; any leading zero is either padding, or the
+	// (rare) natural encoding of a small value.
+	LeadingZeros []int `json:"leadingZeros"`
+	// ByteLengths holds the number of segments whose value needs exactly n
+	// bytes, keyed by n; for generated tokens, this is a lower bound on the
+	// number of random bytes that were encoded.
+	ByteLengths map[int]int `json:"byteLengths"`
+}
+
+// NewCorpus returns an empty corpus.
+func NewCorpus() *Corpus {
+	return &Corpus{
+		Tokens:   0,
+		Skipped:  0,
+		Prefixes: make(map[string]int),
+		Segments: make(map[int]*SegmentStats),
+	}
+}
+
+// Analyze returns the statistics of the given tokens.
+func Analyze(tokens []string) *Corpus {
+	c := NewCorpus()
+	for _, tok := range tokens {
+		c.Add(tok)
+	}
+
+	return c
+}
+
+// Add adds the given token to the corpus, returning false if it was skipped
+// for not having a valid schema.
+func (c *Corpus) Add(tok string) bool {
+	token := ghtoken.ParseGhToken(tok)
+	if !token.SchemaValid {
+		c.Skipped++
+
+		return false
+	}
+
+	s, _ := ghtoken.GetSchema(token.Prefix)
+	codec := s.Codec()
+
+	c.Tokens++
+	c.Prefixes[token.Prefix]++
+	for _, seg := range strings.Split(token.EncodedInput, ghtoken.Sep) {
+		c.segment(len(seg)).add(codec, seg)
+	}
+
+	return true
+}
+
+// Get the statistics of segments of the given length, creating them if
+// needed.
+func (c *Corpus) segment(length int) *SegmentStats {
+	st, found := c.Segments[length]
+	if !found {
+		st = &SegmentStats{
+			Length:       length,
+			Count:        0,
+			Positions:    make([][base62.AlphabetSize]int, length),
+			LeadingZeros: make([]int, length+1),
+			ByteLengths:  make(map[int]int),
+		}
+		c.Segments[length] = st
+	}
+
+	return st
+}
+
+// SegmentLengths returns the lengths of the analyzed segments, in ascending
+// order.
+func (c *Corpus) SegmentLengths() []int {
+	lengths := make([]int, 0, len(c.Segments))
+	for length := range c.Segments {
+		lengths = append(lengths, length)
+	}
+	sort.Ints(lengths)
+
+	return lengths
+}
+
+// Add a segment, encoded w/ the given codec, to the statistics.
+func (st *SegmentStats) add(codec *base62.Codec, seg string) {
+	st.Count++
+
+	zeros := 0
+	for i := 0; i < len(seg); i++ {
+		v := codec.Index(seg[i])
+		st.Positions[i][v]++
+		if v == 0 && zeros == i {
+			zeros++
+		}
+	}
+	st.LeadingZeros[zeros]++
+
+	value, _ := codec.Decode(seg)
+	st.ByteLengths[len(value)]++
+}
+
+// Padded returns the number of segments that began w/ at least one zero
+// symbol.
+func (st *SegmentStats) Padded() int {
+	return st.Count - st.LeadingZeros[0]
+}
+
+// ByteLengthKeys returns the byte lengths observed, in ascending order.
+func (st *SegmentStats) ByteLengthKeys() []int {
+	keys := make([]int, 0, len(st.ByteLengths))
+	for n := range st.ByteLengths {
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
+
+// minPadObservations is the number of segments after which, if none were
+// padded, padding is assumed to be absent; uniformly distributed values
+// begin w/ a zero symbol 1 in 62 times, so they would be padded at least
+// once w/ 99% probability.
+var minPadObservations = int(math.Ceil(math.Log(0.01) / math.Log(1-1.0/base62.AlphabetSize))) //nolint:gomnd
+
+// Profile returns a calibration profile that makes a generator resemble the
+// corpus, w/ the given description of the corpus; see ghtoken.Profile.
+func (c *Corpus) Profile(source string) *ghtoken.Profile {
+	p := &ghtoken.Profile{
+		Source:        source,
+		PrefixWeights: make(map[string]float64, len(c.Prefixes)),
+		Segments:      make(map[int]ghtoken.SegmentProfile, len(c.Segments)),
+	}
+
+	for prefix, count := range c.Prefixes {
+		p.PrefixWeights[prefix] = float64(count) / float64(c.Tokens)
+	}
+
+	for length, st := range c.Segments {
+		seg := ghtoken.SegmentProfile{
+			ByteLengthWeights: make(map[int]float64, len(st.ByteLengths)),
+			Pad:               st.Padded() > 0 || st.Count < minPadObservations,
+		}
+		for n, count := range st.ByteLengths {
+			seg.ByteLengthWeights[n] = float64(count) / float64(st.Count)
+		}
+		p.Segments[length] = seg
+	}
+
+	return p
+}
@@ -0,0 +1,256 @@
+// Package analysis provides statistics over corpora of tokens.
+// This section of the analysis package holds the empirical checksum strength
+// estimator, which measures how often corrupted tokens still pass their
+// checksum.
+package analysis
+
+import (
+	"math"
+	"slices"
+
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// Mutation is a class of corruption, applied to valid tokens to measure how
+// often the corrupted tokens still pass their checksum.
+type Mutation struct {
+	Name        string
+	Description string
+	// Mutate corrupts the given valid token of the given schema, which it may
+	// modify in place, returning the corrupted token; it returns nil if the
+	// token can't be corrupted this way (e.g. there's no letter to flip).
+	Mutate func(r *datautil.Rand, s schema.Schema, tok []byte) []byte
+	// Rate returns the theoretical rate at which tokens of the given schema,
+	// corrupted this way, still pass their checksum.
+	Rate func(s schema.Schema) float64
+}
+
+// ChecksumResult holds the results of corrupting tokens w/ a mutation.
+type ChecksumResult struct {
+	Mutation Mutation
+	// Trials is the number of tokens corrupted; tokens that can't be
+	// corrupted w/ the mutation aren't counted.
+	Trials uint64
+	// Passed is the number of corrupted tokens that still passed their
+	// checksum.
+	Passed uint64
+	// Rate is the theoretical rate at which corrupted tokens pass.
+	Rate float64
+}
+
+// Mutations returns the classes of corruption the estimator measures by
+// default: random payloads (i.e. random strings that happen to have a valid
+// prefix), the typos the checksum is meant to catch, and swapping the prefix
+// for another of the same layout, which the checksum can't catch at all
+// since it only covers the payload.
+func Mutations() []Mutation {
+	return []Mutation{
+		{Name: "random", Description: "every symbol of the payload replaced at random", Mutate: mutateRandom, Rate: randomRate},
+		{Name: "substitution", Description: "one symbol replaced w/ a different symbol", Mutate: mutateSubstitution, Rate: burstRate},
+		{Name: "case flip", Description: "the case of one letter flipped", Mutate: mutateCaseFlip, Rate: burstRate},
+		{Name: "transposition", Description: "two different, adjacent symbols swapped", Mutate: mutateTransposition, Rate: burstRate},
+		{Name: "double substitution", Description: "two symbols replaced w/ different symbols", Mutate: mutateDoubleSubstitution, Rate: collisionRate},
+		{Name: "prefix substitution", Description: "the prefix replaced w/ another registered prefix of the same layout", Mutate: mutatePrefix, Rate: prefixRate},
+	}
+}
+
+// EstimateChecksum corrupts the given number of tokens w/ each of the given
+// mutations, cycling through the given valid tokens of the given schema and
+// drawing randomness from r, and counts how many corrupted tokens still pass
+// their checksum.
+func EstimateChecksum(s schema.Schema, tokens []string, r *datautil.Rand, mutations []Mutation, trials uint64) []ChecksumResult {
+	results := make([]ChecksumResult, len(mutations))
+	buf := make([]byte, 0, len(s.Prefix)+len(ghtoken.Sep)+s.PayloadLength())
+	var v ghtoken.View
+	for i, m := range mutations {
+		results[i] = ChecksumResult{Mutation: m, Trials: 0, Passed: 0, Rate: m.Rate(s)}
+		if len(tokens) < 1 {
+			continue
+		}
+
+		for n := uint64(0); n < trials; n++ {
+			tok := m.Mutate(r, s, append(buf[:0], tokens[n%uint64(len(tokens))]...))
+			if tok == nil {
+				continue
+			}
+
+			results[i].Trials++
+			// Unverified checksums are measured too, as they are assumed.
+			if ghtoken.ParseView(tok, &v) && v.Valid() && v.HasValidChecksum() {
+				results[i].Passed++
+			}
+		}
+	}
+
+	return results
+}
+
+// hasBurstGuarantee returns whether or not the checksum of the given schema
+// is a CRC32, which detects every burst error of at most 32 bits; a single
+// substituted symbol is an 8 bit burst, and two swapped adjacent symbols a
+// 16 bit burst, of the token's text.
+func hasBurstGuarantee(s schema.Schema) bool {
+	name := s.Checksum.Name()
+
+	return name == schema.CRC32IEEE.Name() || name == schema.CRC32C.Name()
+}
+
+// The rate at which a random payload passes: it's checksum must be exactly
+// the encoded checksum of it's input.
+func randomRate(s schema.Schema) float64 {
+	return math.Pow(float64(len(s.Alphabet)), -float64(s.ChecksumLength))
+}
+
+// The rate at which a small corruption passes: never, for a CRC32, otherwise
+// at most the rate at which an arbitrary corruption passes.
+func burstRate(s schema.Schema) float64 {
+	if hasBurstGuarantee(s) {
+		return 0
+	}
+
+	return collisionRate(s)
+}
+
+// The rate at which an arbitrary corruption passes: at most the chance that
+// the checksum of the corrupted input matches, i.e. 2^-32.
+func collisionRate(schema.Schema) float64 {
+	return math.Pow(2, -32) //nolint:gomnd
+}
+
+// The rate at which a swapped prefix passes: always, since the checksum only
+// covers the payload.
+func prefixRate(schema.Schema) float64 {
+	return 1
+}
+
+// Return the indices of the symbols of the given token's payload, skipping
+// separators between segments.
+func symbolIndices(s schema.Schema, tok []byte, keep func(c byte) bool) []int {
+	lead := len(s.Prefix) + len(ghtoken.Sep)
+	indices := make([]int, 0, len(tok)-lead)
+	for i := lead; i < len(tok); i++ {
+		if !s.SepAt(i-lead) && keep(tok[i]) {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// Return any symbol.
+func anySymbol(byte) bool {
+	return true
+}
+
+// Return whether or not the given symbol is a letter.
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// Replace the symbol at the given index w/ a different symbol at random.
+func substitute(r *datautil.Rand, s schema.Schema, tok []byte, i int) {
+	c := s.Alphabet[r.Intn(len(s.Alphabet)-1)]
+	if c == tok[i] {
+		c = s.Alphabet[len(s.Alphabet)-1]
+	}
+	tok[i] = c
+}
+
+// Replace every symbol of the payload at random.
+func mutateRandom(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	for _, i := range symbolIndices(s, tok, anySymbol) {
+		tok[i] = s.Alphabet[r.Intn(len(s.Alphabet))]
+	}
+
+	return tok
+}
+
+// Replace one symbol w/ a different symbol.
+func mutateSubstitution(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	indices := symbolIndices(s, tok, anySymbol)
+	substitute(r, s, tok, indices[r.Intn(len(indices))])
+
+	return tok
+}
+
+// Flip the case of one letter, if the flipped letter is in the alphabet.
+func mutateCaseFlip(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	indices := symbolIndices(s, tok, isLetter)
+	if len(indices) < 1 {
+		return nil
+	}
+
+	i := indices[r.Intn(len(indices))]
+	flipped := tok[i] ^ ('a' - 'A')
+	if !s.InAlphabet(flipped) {
+		return nil
+	}
+	tok[i] = flipped
+
+	return tok
+}
+
+// Swap two different, adjacent symbols.
+func mutateTransposition(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	indices := symbolIndices(s, tok, anySymbol)
+	pairs := make([]int, 0, len(indices))
+	for j := 1; j < len(indices); j++ {
+		a, b := indices[j-1], indices[j]
+		if b == a+1 && tok[a] != tok[b] {
+			pairs = append(pairs, a)
+		}
+	}
+	if len(pairs) < 1 {
+		return nil
+	}
+
+	i := pairs[r.Intn(len(pairs))]
+	tok[i], tok[i+1] = tok[i+1], tok[i]
+
+	return tok
+}
+
+// Replace two symbols w/ different symbols.
+func mutateDoubleSubstitution(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	indices := symbolIndices(s, tok, anySymbol)
+	if len(indices) < 2 { //nolint:gomnd
+		return nil
+	}
+
+	first := r.Intn(len(indices))
+	second := r.Intn(len(indices) - 1)
+	if second >= first {
+		second++
+	}
+	substitute(r, s, tok, indices[first])
+	substitute(r, s, tok, indices[second])
+
+	return tok
+}
+
+// Replace the prefix w/ another registered prefix of the same layout, at
+// random.
+func mutatePrefix(r *datautil.Rand, s schema.Schema, tok []byte) []byte {
+	others := make([]string, 0)
+	for _, o := range schema.Default().Schemas() {
+		if o.Prefix != s.Prefix && sameLayout(s, o) {
+			others = append(others, o.Prefix)
+		}
+	}
+	if len(others) < 1 {
+		return nil
+	}
+
+	payload := tok[len(s.Prefix):]
+	prefix := others[r.Intn(len(others))]
+
+	return append([]byte(prefix), payload...)
+}
+
+// Return whether or not the given schemas lay out and checksum their payloads
+// the same way.
+func sameLayout(a, b schema.Schema) bool {
+	return slices.Equal(a.Segments, b.Segments) && a.ChecksumLength == b.ChecksumLength && a.Alphabet == b.Alphabet && a.Checksum.Name() == b.Checksum.Name()
+}
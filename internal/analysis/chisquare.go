@@ -0,0 +1,180 @@
+// Package analysis provides statistics over corpora of tokens.
+// This section of the analysis package holds chi-square tests, for comparing
+// corpora against each other and against a uniform distribution.
+package analysis
+
+import (
+	"math"
+)
+
+const (
+	// maxIterations bounds the series and continued fraction evaluations of
+	// the incomplete gamma function; both converge well within it for the
+	// degrees of freedom seen here.
+	maxIterations = 1000
+	// epsilon is the relative precision the evaluations stop at.
+	epsilon = 1e-15
+	// tiny stands in for zero in the continued fraction, to avoid dividing by
+	// zero.
+	tiny = 1e-300
+)
+
+// ChiSquare is the result of a chi-square test; a small PValue (e.g. < 0.05)
+// means the observed counts are unlikely under the tested hypothesis.
+type ChiSquare struct {
+	Statistic float64 `json:"statistic"`
+	DF        int     `json:"df"`
+	PValue    float64 `json:"pValue"`
+}
+
+// Homogeneity tests whether two sets of counts, over the same categories,
+// were drawn from the same distribution (a 2xk contingency table test);
+// categories that are empty in both sets are ignored.
+func Homogeneity(a, b []int) ChiSquare {
+	totalA, totalB := sum(a), sum(b)
+	total := float64(totalA + totalB)
+	if totalA < 1 || totalB < 1 {
+		return ChiSquare{Statistic: 0, DF: 0, PValue: 1}
+	}
+
+	stat := 0.0
+	categories := 0
+	for i := range a {
+		col := float64(a[i] + b[i])
+		if col == 0 {
+			continue
+		}
+		categories++
+
+		expA := col * float64(totalA) / total
+		expB := col * float64(totalB) / total
+		stat += sq(float64(a[i])-expA)/expA + sq(float64(b[i])-expB)/expB
+	}
+
+	return newChiSquare(stat, categories-1)
+}
+
+// GoodnessOfFit tests whether a set of counts was drawn from a uniform
+// distribution over it's categories.
+func GoodnessOfFit(counts []int) ChiSquare {
+	n := sum(counts)
+	if n < 1 || len(counts) < 2 { //nolint:gomnd
+		return ChiSquare{Statistic: 0, DF: 0, PValue: 1}
+	}
+
+	exp := float64(n) / float64(len(counts))
+	stat := 0.0
+	for _, c := range counts {
+		stat += sq(float64(c)-exp) / exp
+	}
+
+	return newChiSquare(stat, len(counts)-1)
+}
+
+// Combine sums the statistics and degrees of freedom of independent tests
+// into a single test.
+func Combine(tests ...ChiSquare) ChiSquare {
+	stat := 0.0
+	df := 0
+	for _, t := range tests {
+		stat += t.Statistic
+		df += t.DF
+	}
+
+	return newChiSquare(stat, df)
+}
+
+// Build a test result from a statistic and it's degrees of freedom.
+func newChiSquare(stat float64, df int) ChiSquare {
+	return ChiSquare{Statistic: stat, DF: df, PValue: chiSquareSF(stat, df)}
+}
+
+// Survival function of the chi-square distribution, i.e. the probability of
+// a statistic at least as large as x w/ df degrees of freedom.
+func chiSquareSF(x float64, df int) float64 {
+	if df < 1 || x <= 0 {
+		return 1
+	}
+
+	return gammaQ(float64(df)/2, x/2) //nolint:gomnd
+}
+
+// Regularized upper incomplete gamma function Q(a, x); evaluated by series
+// for x < a+1, and by continued fraction otherwise, as each converges
+// quickly in that range.
+func gammaQ(a, x float64) float64 {
+	if x < a+1 {
+		return 1 - gammaPSeries(a, x)
+	}
+
+	return gammaQFraction(a, x)
+}
+
+// Regularized lower incomplete gamma function P(a, x), by it's series
+// representation.
+func gammaPSeries(a, x float64) float64 {
+	ap := a
+	del := 1 / a
+	total := del
+	for i := 0; i < maxIterations; i++ {
+		ap++
+		del *= x / ap
+		total += del
+		if math.Abs(del) < math.Abs(total)*epsilon {
+			break
+		}
+	}
+
+	return total * math.Exp(-x+a*math.Log(x)-lgamma(a))
+}
+
+// Regularized upper incomplete gamma function Q(a, x), by it's continued
+// fraction representation (evaluated w/ the modified Lentz method).
+func gammaQFraction(a, x float64) float64 {
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < maxIterations; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < epsilon {
+			break
+		}
+	}
+
+	return math.Exp(-x+a*math.Log(x)-lgamma(a)) * h
+}
+
+// Natural log of the gamma function, for positive arguments.
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+
+	return v
+}
+
+// Sum of the given counts.
+func sum(counts []int) int {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	return total
+}
+
+// Square of the given value.
+func sq(v float64) float64 {
+	return v * v
+}
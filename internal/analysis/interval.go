@@ -0,0 +1,42 @@
+// Package analysis provides statistics over corpora of tokens.
+// This section of the analysis package holds confidence intervals, for
+// comparing observed rates against predicted probabilities.
+package analysis
+
+import (
+	"math"
+)
+
+// Interval is a confidence interval of a proportion.
+type Interval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Contains returns whether or not the given proportion is inside the
+// interval.
+func (i Interval) Contains(p float64) bool {
+	return i.Low <= p && p <= i.High
+}
+
+// Wilson returns the Wilson score interval of the proportion of successes
+// out of trials, at the given confidence level (e.g. 0.95); unlike the
+// normal approximation, it stays within [0, 1] and behaves well when
+// successes are rare, which they are when collisions are concerned. W/o
+// trials, the interval is all of [0, 1].
+func Wilson(successes, trials int, confidence float64) Interval {
+	if trials < 1 {
+		return Interval{Low: 0, High: 1}
+	}
+
+	// z is the standard normal quantile of the two-sided confidence level.
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	n := float64(trials)
+	p := float64(successes) / n
+
+	denom := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denom                    //nolint:gomnd
+	half := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom //nolint:gomnd
+
+	return Interval{Low: math.Max(0, center-half), High: math.Min(1, center+half)}
+}
@@ -0,0 +1,236 @@
+// Package analysis provides statistics over corpora of tokens.
+// This section of the analysis package holds comparisons between corpora, and
+// the rendering of reports.
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pyqlsa/token-forge/pkg/base62"
+)
+
+// topSymbols is the number of most frequent symbols shown for each position
+// in a text report.
+const topSymbols = 3
+
+// Comparison holds chi-square tests of whether the segments of a given
+// length were drawn from the same distribution in two corpora.
+type Comparison struct {
+	Length int `json:"length"`
+	// Positions holds a test of the symbol frequencies at each position.
+	Positions []ChiSquare `json:"positions"`
+	// AllPositions combines the tests of every position.
+	AllPositions ChiSquare `json:"allPositions"`
+	LeadingZeros ChiSquare `json:"leadingZeros"`
+	ByteLengths  ChiSquare `json:"byteLengths"`
+}
+
+// Compare compares the segments of every length found in both corpora.
+func Compare(a, b *Corpus) []Comparison {
+	comparisons := make([]Comparison, 0)
+	for _, length := range a.SegmentLengths() {
+		sb, found := b.Segments[length]
+		if !found {
+			continue
+		}
+		sa := a.Segments[length]
+
+		cmp := Comparison{
+			Length:       length,
+			Positions:    make([]ChiSquare, length),
+			AllPositions: ChiSquare{Statistic: 0, DF: 0, PValue: 1},
+			LeadingZeros: Homogeneity(sa.LeadingZeros, sb.LeadingZeros),
+			ByteLengths:  Homogeneity(alignByteLengths(sa, sb)),
+		}
+		for i := range cmp.Positions {
+			cmp.Positions[i] = Homogeneity(sa.Positions[i][:], sb.Positions[i][:])
+		}
+		cmp.AllPositions = Combine(cmp.Positions...)
+		comparisons = append(comparisons, cmp)
+	}
+
+	return comparisons
+}
+
+// Uniformity tests whether the symbols at each position of the segments
+// were drawn from a uniform distribution.
+func (st *SegmentStats) Uniformity() []ChiSquare {
+	tests := make([]ChiSquare, len(st.Positions))
+	for i := range st.Positions {
+		tests[i] = GoodnessOfFit(st.Positions[i][:])
+	}
+
+	return tests
+}
+
+// Build aligned counts of the byte lengths observed in either set of
+// statistics.
+func alignByteLengths(a, b *SegmentStats) ([]int, []int) {
+	keys := make(map[int]bool)
+	for n := range a.ByteLengths {
+		keys[n] = true
+	}
+	for n := range b.ByteLengths {
+		keys[n] = true
+	}
+
+	sorted := make([]int, 0, len(keys))
+	for n := range keys {
+		sorted = append(sorted, n)
+	}
+	sort.Ints(sorted)
+
+	ca := make([]int, len(sorted))
+	cb := make([]int, len(sorted))
+	for i, n := range sorted {
+		ca[i] = a.ByteLengths[n]
+		cb[i] = b.ByteLengths[n]
+	}
+
+	return ca, cb
+}
+
+// Report is the result of analyzing a corpus, and optionally comparing it to
+// a second corpus.
+type Report struct {
+	Name        string       `json:"name"`
+	Corpus      *Corpus      `json:"corpus"`
+	CompareName string       `json:"compareName,omitempty"`
+	Compare     *Corpus      `json:"compare,omitempty"`
+	Comparisons []Comparison `json:"comparisons,omitempty"`
+}
+
+// NewReport returns a report of the given corpus, compared to the other
+// corpus if it isn't nil.
+func NewReport(name string, corpus *Corpus, otherName string, other *Corpus) *Report {
+	//nolint:exhaustruct
+	r := &Report{
+		Name:   name,
+		Corpus: corpus,
+	}
+
+	if other != nil {
+		r.CompareName = otherName
+		r.Compare = other
+		r.Comparisons = Compare(corpus, other)
+	}
+
+	return r
+}
+
+// WriteText writes the report in a human readable form; symbols are shown
+// by their value in the GitHub alphabet, regardless of the alphabet of the
+// analyzed tokens, and the full symbol frequencies are left to the json
+// form of the report.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0) //nolint:gomnd
+
+	writeCorpus(tw, r.Name, r.Corpus)
+	if r.Compare != nil {
+		writeCorpus(tw, r.CompareName, r.Compare)
+		for _, cmp := range r.Comparisons {
+			writeComparison(tw, r.Name, r.CompareName, cmp)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+
+	return nil
+}
+
+// Write the statistics of a corpus.
+func writeCorpus(w io.Writer, name string, c *Corpus) {
+	fmt.Fprintf(w, "corpus %s: %d tokens (%d skipped w/o a valid schema)\n", name, c.Tokens, c.Skipped)
+
+	prefixes := make([]string, 0, len(c.Prefixes))
+	for p := range c.Prefixes {
+		prefixes = append(prefixes, fmt.Sprintf("%s=%d", p, c.Prefixes[p]))
+	}
+	sort.Strings(prefixes)
+	fmt.Fprintf(w, "  prefixes: %s\n", strings.Join(prefixes, " "))
+
+	for _, length := range c.SegmentLengths() {
+		st := c.Segments[length]
+		fmt.Fprintf(w, "  segments of %d characters: %d\n", length, st.Count)
+		fmt.Fprintf(w, "    padded: %d (%s; %s expected of uniform values)\n",
+			st.Padded(), percent(st.Padded(), st.Count), percent(1, base62.AlphabetSize))
+
+		zeros := make([]string, 0)
+		for n, count := range st.LeadingZeros {
+			if count > 0 {
+				zeros = append(zeros, fmt.Sprintf("%d=%d", n, count))
+			}
+		}
+		fmt.Fprintf(w, "    leading zeros: %s\n", strings.Join(zeros, " "))
+
+		lengths := make([]string, 0)
+		for _, n := range st.ByteLengthKeys() {
+			lengths = append(lengths, fmt.Sprintf("%d=%d (%s)", n, st.ByteLengths[n], percent(st.ByteLengths[n], st.Count)))
+		}
+		fmt.Fprintf(w, "    implied byte lengths: %s\n", strings.Join(lengths, " "))
+
+		uniformity := st.Uniformity()
+		fmt.Fprintf(w, "    positions vs uniform: %s\n", formatTest(Combine(uniformity...)))
+		fmt.Fprintf(w, "    \tposition\ttop symbols\tchi-square\tdf\tp\n")
+		for i, test := range uniformity {
+			fmt.Fprintf(w, "    \t%d\t%s\t%.2f\t%d\t%.4f\n", i, formatTop(st.Positions[i]), test.Statistic, test.DF, test.PValue)
+		}
+	}
+}
+
+// Write the comparison of two corpora.
+func writeComparison(w io.Writer, name, otherName string, cmp Comparison) {
+	fmt.Fprintf(w, "comparison of %s and %s, segments of %d characters:\n", name, otherName, cmp.Length)
+
+	worst := 0
+	for i, test := range cmp.Positions {
+		if test.PValue < cmp.Positions[worst].PValue {
+			worst = i
+		}
+	}
+
+	fmt.Fprintf(w, "  positions: %s\n", formatTest(cmp.AllPositions))
+	if len(cmp.Positions) > 0 {
+		fmt.Fprintf(w, "  least alike position: %d, %s\n", worst, formatTest(cmp.Positions[worst]))
+	}
+	fmt.Fprintf(w, "  leading zeros: %s\n", formatTest(cmp.LeadingZeros))
+	fmt.Fprintf(w, "  implied byte lengths: %s\n", formatTest(cmp.ByteLengths))
+}
+
+// Format the most frequent symbols of a position, w/ their counts.
+func formatTop(counts [base62.AlphabetSize]int) string {
+	values := make([]int, base62.AlphabetSize)
+	for i := range values {
+		values[i] = i
+	}
+	sort.SliceStable(values, func(i, j int) bool { return counts[values[i]] > counts[values[j]] })
+
+	top := make([]string, 0, topSymbols)
+	for _, v := range values[:topSymbols] {
+		if counts[v] > 0 {
+			top = append(top, fmt.Sprintf("%c=%d", base62.GitHubAlphabet[v], counts[v]))
+		}
+	}
+
+	return strings.Join(top, " ")
+}
+
+// Format a test result.
+func formatTest(t ChiSquare) string {
+	return fmt.Sprintf("chi-square %.2f, df %d, p %.4f", t.Statistic, t.DF, t.PValue)
+}
+
+// Format a ratio as a percentage.
+func percent(n, total int) string {
+	if total < 1 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(total)) //nolint:gomnd
+}
@@ -3,6 +3,7 @@ package bar
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"sync"
@@ -20,12 +21,36 @@ type ProgressBar struct {
 
 const defaultBuf = 10000
 
+// output is where new bars are drawn.
+var output = struct {
+	sync.Mutex
+	w io.Writer
+}{w: os.Stderr}
+
+// SetOutput sets where new bars are drawn, stderr by default; bars drawn to
+// io.Discard are hidden, e.g. while benchmarking.
+func SetOutput(w io.Writer) {
+	output.Lock()
+	defer output.Unlock()
+	output.w = w
+}
+
+// options returns the options of a new bar, drawn to the current output.
+func options() []progressbar.Option {
+	output.Lock()
+	w := output.w
+	output.Unlock()
+
+	return append([]progressbar.Option{
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprintf(w, "\n")
+		}),
+	}, defaultOpts...)
+}
+
 // common options.
 var defaultOpts = []progressbar.Option{
-	progressbar.OptionSetWriter(os.Stderr),
-	progressbar.OptionOnCompletion(func() {
-		fmt.Fprintf(os.Stderr, "\n")
-	}),
 	progressbar.OptionEnableColorCodes(true),
 	progressbar.OptionFullWidth(),
 	progressbar.OptionShowCount(),
@@ -66,14 +91,14 @@ func NewBufferedBar(num uint64, buffer int) *ProgressBar {
 
 	if num == 0 || num > math.MaxInt64 {
 		return &ProgressBar{ //nolint:exhaustruct
-			bar:   progressbar.NewOptions(-1, defaultOpts...),
+			bar:   progressbar.NewOptions(-1, options()...),
 			buf:   b,
 			count: 0,
 		}
 	}
 
 	return &ProgressBar{ //nolint:exhaustruct
-		bar:   progressbar.NewOptions64(int64(num), defaultOpts...),
+		bar:   progressbar.NewOptions64(int64(num), options()...),
 		buf:   b,
 		count: 0,
 	}
@@ -94,6 +119,23 @@ func (b *ProgressBar) Inc() error {
 	return nil
 }
 
+// Add increments the progress bar by the given amount, in multiples of it's
+// buffer.
+func (b *ProgressBar) Add(n int) error {
+	b.Lock()
+	defer b.Unlock()
+	b.count += n
+
+	if b.count >= b.buf {
+		add := b.count - b.count%b.buf
+		b.count -= add
+
+		return b.bar.Add(add) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
 // Close closes the bar.
 func (b *ProgressBar) Close() error {
 	b.Lock()
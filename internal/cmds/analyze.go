@@ -0,0 +1,87 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the analyze
+// command.
+package cmds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pyqlsa/token-forge/internal/analysis"
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+// AnalyzeCmd represents the corpus analysis cli command.
+type AnalyzeCmd struct {
+	Globals
+	SchemaArgs
+	File    string `help:"Path to file with a corpus of tokens."                                                                                  required:"" short:"f" type:"existingfile"`
+	Compare string `help:"Path to file with a second corpus of tokens (e.g. generate output) to compare the first against w/ chi-square tests." short:"c" type:"existingfile"`
+	JSON    bool   `help:"Print the full report as json, including the frequency of every symbol at every position."`
+	Profile string `help:"Write a calibration profile of the (first) corpus to the given path, for tuning generated tokens to resemble it."            type:"path"`
+}
+
+// Run the analyze command to report statistics of a corpus of tokens.
+func (a *AnalyzeCmd) Run() error {
+	if err := loadSchemaFile(a.SchemaFile); err != nil {
+		return err
+	}
+
+	corpus, err := analyzeFile(a.File)
+	if err != nil {
+		return err
+	}
+
+	var other *analysis.Corpus
+	if len(a.Compare) > 0 {
+		if other, err = analyzeFile(a.Compare); err != nil {
+			return err
+		}
+	}
+
+	if len(a.Profile) > 0 {
+		if err := writeProfile(a.Profile, corpus.Profile(a.File)); err != nil {
+			return err
+		}
+	}
+
+	report := analysis.NewReport(a.File, corpus, a.Compare, other)
+	if a.JSON {
+		if err := fileutil.WriteJSON(os.Stdout, report); err != nil {
+			return fmt.Errorf("failed printing report: %w", err)
+		}
+
+		return nil
+	}
+
+	return report.WriteText(os.Stdout) //nolint:wrapcheck
+}
+
+// Analyze the corpus of tokens in the given file.
+func analyzeFile(file string) (*analysis.Corpus, error) {
+	tokens, err := fileutil.ReadLines(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file '%s': %w", file, err)
+	}
+
+	return analysis.Analyze(tokens), nil
+}
+
+// Write the given calibration profile to the given file.
+func writeProfile(file string, profile *ghtoken.Profile) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //#nosec:G304
+	if err != nil {
+		return fmt.Errorf("failed creating profile '%s': %w", file, err)
+	}
+
+	err = fileutil.WriteJSON(f, profile)
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing profile '%s': %w", file, err)
+	}
+
+	return nil
+}
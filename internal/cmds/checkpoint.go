@@ -0,0 +1,157 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the checkpoints of long-running
+// local collision tests, so they can be resumed once interrupted.
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+)
+
+// CheckpointArgs represents parameters for checkpointing a local collision
+// test.
+type CheckpointArgs struct {
+	Checkpoint         string        `group:"Checkpoint" help:"Periodically save the progress of the test to the given state file, so it can be resumed if interrupted."                                                                 type:"path"`
+	CheckpointInterval time.Duration `default:"1m"       group:"Checkpoint"                                                                                                                                                              help:"How often to save the progress of the test to the state file."`
+	Resume             string        `group:"Checkpoint" help:"Resume the test saved in the given state file, exactly where it stopped; the test's parameters are taken from the state file, and it's progress keeps being saved to it." type:"existingfile"`
+}
+
+// checkpointState is the progress of a local collision test, as saved to the
+// state file; the tokens of a test are generated in batches seeded by their
+// index (see GeneratorArgs.batchGenerators), so the progress is simply how
+// many batches have been tested.
+type checkpointState struct {
+	Seed       *int64             `json:"seed,omitempty"`
+	Profile    string             `json:"profile,omitempty"`
+	SchemaFile string             `json:"schemaFile,omitempty"`
+	Prefix     string             `json:"prefix,omitempty"`
+	BatchSize  int                `json:"batchSize"`
+	NumTokens  uint64             `json:"numTokens"`
+	Batches    uint64             `json:"batches"`
+	Tested     uint64             `json:"tested"`
+	Collisions []string           `json:"collisions"`
+	Database   checkpointDatabase `json:"database"`
+}
+
+// checkpointDatabase references the test token database of a local collision
+// test; it is either a saved database, or rebuilt from the seed.
+type checkpointDatabase struct {
+	File      string  `json:"file,omitempty"`
+	NumTests  uint64  `json:"numTests"`
+	Workers   int     `json:"workers"`
+	BloomFPR  float64 `json:"bloomFPR,omitempty"`
+	BloomOnly bool    `json:"bloomOnly,omitempty"`
+}
+
+// readCheckpoint reads the state file at the given path.
+func readCheckpoint(name string) (*checkpointState, error) {
+	data, err := os.ReadFile(name) //#nosec:G304
+	if err != nil {
+		return nil, fmt.Errorf("failed reading checkpoint: %w", err)
+	}
+
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed parsing checkpoint: %w", err)
+	}
+
+	return &state, nil
+}
+
+// writeCheckpoint writes the state file at the given path, replacing it
+// atomically, so an interruption never leaves it half written.
+func writeCheckpoint(name string, state *checkpointState) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("failed creating checkpoint: %w", err)
+	}
+
+	err = fileutil.WriteJSON(tmp, state)
+	if cerr := tmp.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// checkpointer tracks the batches of a local collision test as workers
+// finish them, in any order, and periodically saves the progress; only
+// batches w/ every earlier batch finished count as tested, so the saved
+// progress is always a prefix of the test.
+type checkpointer struct {
+	mu       sync.Mutex
+	name     string
+	interval time.Duration
+	last     time.Time
+	state    *checkpointState
+	// pending holds the collisions of finished batches past the tested ones.
+	pending map[uint64][]string
+}
+
+// newCheckpointer returns a checkpointer that saves the given state to the
+// given state file at the given interval.
+func newCheckpointer(name string, interval time.Duration, state *checkpointState) *checkpointer {
+	return &checkpointer{
+		mu:       sync.Mutex{},
+		name:     name,
+		interval: interval,
+		last:     time.Now(),
+		state:    state,
+		pending:  make(map[uint64][]string),
+	}
+}
+
+// done records the collisions of a finished batch, saving the progress if
+// it's been at least the interval since it was last saved.
+func (c *checkpointer) done(batch uint64, collisions []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending[batch] = collisions
+	for {
+		found, ok := c.pending[c.state.Batches]
+		if !ok {
+			break
+		}
+		delete(c.pending, c.state.Batches)
+		c.state.Collisions = append(c.state.Collisions, found...)
+		c.state.Batches++
+	}
+	c.state.Tested = min(c.state.Batches*uint64(c.state.BatchSize), c.state.NumTokens)
+
+	if time.Since(c.last) >= c.interval {
+		if err := c.saveLocked(); err != nil {
+			log.Printf("error saving checkpoint: %v", err)
+		}
+	}
+}
+
+// save saves the progress.
+func (c *checkpointer) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.saveLocked()
+}
+
+// Save the progress, w/ the lock held.
+func (c *checkpointer) saveLocked() error {
+	c.last = time.Now()
+
+	return writeCheckpoint(c.name, c.state)
+}
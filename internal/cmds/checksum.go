@@ -0,0 +1,118 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the checksum
+// command.
+package cmds
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pyqlsa/token-forge/internal/analysis"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+// ChecksumCmd represents the checksum strength cli command.
+type ChecksumCmd struct {
+	Globals
+	SchemaArgs
+	Seed       *int64  `help:"Seed for deterministic trials; the same seed always corrupts the same tokens the same way, and so gives the same results; if not specified, tokens are generated and corrupted w/ secure randomness."`
+	Prefix     string  `default:"ghp"     help:"Prefix of the tokens to corrupt."                                       short:"p"`
+	Trials     uint64  `default:"1000000" help:"Number of corrupted tokens to test for each class of corruption."       short:"k"`
+	NumTokens  int     `default:"1000"    help:"Number of distinct valid tokens to corrupt; trials cycle through them." short:"n"`
+	Confidence float64 `default:"0.95"    help:"Confidence level of the reported intervals; must be greater than 0 and less than 1."`
+}
+
+// Run the checksum command to measure how often corrupted tokens still pass
+// their checksum.
+func (c *ChecksumCmd) Run() error {
+	if err := loadSchemaFile(c.SchemaFile); err != nil {
+		return err
+	}
+
+	s, ok := ghtoken.GetSchema(c.Prefix)
+	switch {
+	case !ok:
+		return fmt.Errorf("prefix '%s' is not a valid token prefix", c.Prefix)
+	case c.Trials < 1:
+		return fmt.Errorf("number of trials must be at least 1")
+	case c.NumTokens < 1:
+		return fmt.Errorf("number of tokens must be at least 1")
+	case c.Confidence <= 0 || c.Confidence >= 1:
+		return fmt.Errorf("confidence level must be greater than 0 and less than 1")
+	}
+
+	gen, r := ghtoken.NewGenerator(datautil.NewSecureRand()), datautil.NewSecureRand()
+	if c.Seed != nil {
+		gen, r = ghtoken.NewSeededGenerator(*c.Seed), datautil.NewSeededRand(datautil.DeriveSeed(*c.Seed, 0))
+	}
+
+	tokens := make([]string, c.NumTokens)
+	for i := range tokens {
+		tokens[i] = gen.Generate(s.Prefix).FullToken
+	}
+
+	mutations := analysis.Mutations()
+	log.Printf("corrupting %d tokens w/ each of %d classes of corruption...", c.Trials, len(mutations))
+	results := analysis.EstimateChecksum(s, tokens, r, mutations, c.Trials)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintf(w, "schema:\t%s (%s)\n", s.Name, s.Prefix)
+	fmt.Fprintf(w, "checksum:\t%s, as %d symbols of a %d symbol alphabet\n", s.Checksum.Name(), s.ChecksumLength, len(s.Alphabet))
+	if s.UnverifiedChecksum {
+		fmt.Fprintln(w, "\t(assumed; GitHub doesn't document this checksum, so it isn't validated)")
+	}
+	fmt.Fprintf(w, "trials:\t%d per class, over %d valid tokens, w/ %g%% confidence intervals\n", c.Trials, c.NumTokens, 100*c.Confidence) //nolint:gomnd
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "corruption\ttrials\tpassed\trate\tinterval\ttheoretical\tagrees\tdetected")
+	undetected := make([]string, 0)
+	for _, res := range results {
+		if res.Trials < 1 {
+			fmt.Fprintf(w, "%s\t0\t-\t-\t-\t%.3g\t-\tn/a\n", res.Mutation.Name, res.Rate)
+
+			continue
+		}
+
+		interval := analysis.Wilson(int(res.Passed), int(res.Trials), c.Confidence)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.3g\t[%.3g, %.3g]\t%.3g\t%s\t%s\n",
+			res.Mutation.Name, res.Trials, res.Passed, float64(res.Passed)/float64(res.Trials),
+			interval.Low, interval.High, res.Rate, formatAgrees(interval, res.Rate), formatDetected(res))
+		if res.Passed > 0 {
+			undetected = append(undetected, res.Mutation.Name)
+		}
+	}
+	fmt.Fprintln(w)
+
+	for _, m := range mutations {
+		fmt.Fprintf(w, "%s:\t%s\n", m.Name, m.Description)
+	}
+	fmt.Fprintln(w)
+
+	if len(undetected) > 0 {
+		fmt.Fprintf(w, "undetected:\t%s\n", strings.Join(undetected, ", "))
+	} else {
+		fmt.Fprintln(w, "undetected:\tnone")
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed printing checksum results: %w", err)
+	}
+
+	return nil
+}
+
+// Format how reliably the checksum detected a class of corruption.
+func formatDetected(res analysis.ChecksumResult) string {
+	switch res.Passed {
+	case 0:
+		return "always"
+	case res.Trials:
+		return "never"
+	default:
+		return "sometimes"
+	}
+}
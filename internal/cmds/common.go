@@ -11,7 +11,10 @@ import (
 	"os"
 
 	"github.com/pyqlsa/token-forge/internal/fileutil"
-	"github.com/pyqlsa/token-forge/internal/ghtoken"
+	"github.com/pyqlsa/token-forge/internal/report"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/schema"
 )
 
 // Globals represents globally shared flags for cli commands.
@@ -29,16 +32,160 @@ type TokenSourceArgs struct {
 
 // TokenParams represents parameters for token generation.
 type TokenParams struct {
-	BatchSize int    `default:"1000"       group:"Token Params"                                                                                                                                help:"When testing for collisions, the number of tokens to test concurrently." short:"b"`
-	NumTokens uint64 `default:"1"          group:"Token Params"                                                                                                                                help:"Number of tokens to test."                                               short:"n"` // max = 18446744073709551615`
+	BatchSize int    `default:"1000"       group:"Token Params"                                                                                                                                help:"When testing for collisions, the number of tokens to test concurrently (login), or the number of tokens each worker pulls at once (local)." short:"b"`
+	NumTokens uint64 `default:"1"          group:"Token Params"                                                                                                                                help:"Number of tokens to test."                                                                                                                  short:"n"` // max = 18446744073709551615`
 	Prefix    string `group:"Token Params" help:"Token prefix to use; if not specified, each generated token will have a randomly selected prefix; only has an effect when generating tokens." short:"p"`
 }
 
+// GeneratorArgs represents parameters for tuning token generation.
+type GeneratorArgs struct {
+	Seed    *int64 `group:"Token Params" help:"Seed for deterministic token generation; the same seed always generates the same sequence of tokens; if not specified, tokens are generated w/ secure randomness; only has an effect when generating tokens."`
+	Profile string `group:"Token Params" help:"Path to a calibration profile (see the analyze command) that tunes generated tokens to resemble an observed corpus; only has an effect when generating tokens."                                              type:"existingfile"`
+}
+
+// generator returns a token generator seeded w/ the seed, or one that uses
+// secure randomness if there's no seed, calibrated w/ the profile if there
+// is one.
+func (a GeneratorArgs) generator() (*ghtoken.Generator, error) {
+	profile, err := a.profile()
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Seed == nil {
+		return ghtoken.NewGenerator(datautil.NewSecureRand(), ghtoken.WithProfile(profile)), nil
+	}
+
+	return ghtoken.NewSeededGenerator(*a.Seed, ghtoken.WithProfile(profile)), nil
+}
+
+// generators returns the given number of token generators, for concurrent
+// use; each is seeded w/ a seed derived from the seed and it's index (see
+// datautil.DeriveSeed), so their sequences are unrelated to each other and
+// to the sequence of generator, or each uses secure randomness if there's no
+// seed. Each is calibrated w/ the profile if there is one.
+func (a GeneratorArgs) generators(n int) ([]*ghtoken.Generator, error) {
+	profile, err := a.profile()
+	if err != nil {
+		return nil, err
+	}
+
+	base := ghtoken.NewGenerator(datautil.NewSecureRand(), ghtoken.WithProfile(profile))
+	gens := make([]*ghtoken.Generator, n)
+	for i := range gens {
+		if a.Seed == nil {
+			gens[i] = base.Fork(datautil.NewSecureRand())
+		} else {
+			gens[i] = base.Fork(datautil.NewSeededRand(datautil.DeriveSeed(*a.Seed, uint64(i))))
+		}
+	}
+
+	return gens, nil
+}
+
+// batchStreams is the first stream of the seeds of batchGenerators; batches
+// take the upper half of the streams, so their sequences never overlap those
+// of generators.
+const batchStreams = 1 << 63
+
+// batchGenerators returns a function that returns a token generator for each
+// batch of a generatedTokenSource; each is seeded w/ a seed derived from the
+// seed and the batch's index (see datautil.DeriveSeed), so a batch's tokens
+// only depend on it's index, or each uses secure randomness if there's no
+// seed. Each is calibrated w/ the profile if there is one.
+func (a GeneratorArgs) batchGenerators() (func(batch uint64) *ghtoken.Generator, error) {
+	profile, err := a.profile()
+	if err != nil {
+		return nil, err
+	}
+
+	// the profile is calibrated once, and shared by every batch's generator.
+	base := ghtoken.NewGenerator(datautil.NewSecureRand(), ghtoken.WithProfile(profile))
+	if a.Seed == nil {
+		return func(uint64) *ghtoken.Generator {
+			return base.Fork(datautil.NewSecureRand())
+		}, nil
+	}
+
+	seed := *a.Seed
+
+	return func(batch uint64) *ghtoken.Generator {
+		return base.Fork(datautil.NewSeededRand(datautil.DeriveSeed(seed, batchStreams|batch)))
+	}, nil
+}
+
+// profile returns the calibration profile, or nil if there isn't one.
+func (a GeneratorArgs) profile() (*ghtoken.Profile, error) {
+	if len(a.Profile) < 1 {
+		return nil, nil //nolint:nilnil
+	}
+
+	p, err := ghtoken.LoadProfile(a.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading profile: %w", err)
+	}
+
+	return p, nil
+}
+
 // ProxyConfig represents parameters for setting a proxy.
 type ProxyConfig struct {
 	Proxy string `group:"Proxy Config" help:"Proxy to use for outbound connections."`
 }
 
+// SchemaArgs represents parameters for declaring custom token schemas.
+type SchemaArgs struct {
+	SchemaFile string `group:"Schema Config" help:"Path to a json file declaring custom token schemas; once loaded, custom schemas are treated like the built-in schemas." type:"existingfile"`
+}
+
+// loadSchemaFile registers the custom schemas declared in the given file w/
+// the default schema registry; an empty file name is a no-op.
+func loadSchemaFile(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	if err := schema.LoadFile(file); err != nil {
+		return fmt.Errorf("failed loading custom schemas: %w", err)
+	}
+
+	return nil
+}
+
+// ExitError is an error that exits the cli w/ a specific code, rather than
+// the default of 1.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Error returns the message of the underlying error.
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the code to exit the cli w/.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// newReportWriter returns a writer of reports to stdout in the given format,
+// w/ the given header, that reports SARIF results under the given rules.
+func newReportWriter(format string, header []string, rules ...report.Rule) (*report.Writer, error) {
+	tool := report.Tool{Name: "token-forge", Version: "", InformationURI: "https://github.com/pyqlsa/token-forge", Rules: rules}
+	w, err := report.NewWriter(os.Stdout, report.Format(format), header, tool)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating report: %w", err)
+	}
+
+	return w, nil
+}
+
 // setProxy validates a url string and sets it as a proxy via environment
 // variables; if the string is a valid url, it unsets HTTP_PROXY, HTTPS_PROXY,
 // and NO_PROXY, then sets HTTP_PROXY and HTTPS_PROXY. These variables are
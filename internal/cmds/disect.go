@@ -6,9 +6,12 @@ package cmds
 import (
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/pyqlsa/token-forge/internal/fileutil"
-	"github.com/pyqlsa/token-forge/internal/ghtoken"
+	"github.com/pyqlsa/token-forge/internal/report"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
 )
 
 // DisectCmd represents the disect tokens cli command.
@@ -16,28 +19,59 @@ type DisectCmd struct {
 	Globals
 	TokenSourceArgs
 	TokenParams
+	GeneratorArgs
+	SchemaArgs
+	Format string `default:"json" enum:"table,json,jsonl,csv,sarif" help:"Format of the inspected tokens: table, json, jsonl, csv, or sarif." short:"o"`
+}
+
+// Rules that inspected tokens are reported under, in SARIF reports.
+var (
+	validSchemaRule = report.Rule{
+		ID:                   "valid-schema",
+		ShortDescription:     report.Message{Text: "Token w/ a valid schema"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelNote},
+	}
+	invalidSchemaRule = report.Rule{
+		ID:                   "invalid-schema",
+		ShortDescription:     report.Message{Text: "Token w/ an invalid schema"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelWarning},
+	}
+)
+
+// tokenRecord is an inspected token, as a record of a report.
+type tokenRecord struct {
+	*ghtoken.GhToken
 }
 
 // Run the disect tokens command to inspect GitHub tokens.
 func (d *DisectCmd) Run() error {
+	if err := loadSchemaFile(d.SchemaFile); err != nil {
+		return err
+	}
+
+	w, err := newReportWriter(d.Format, []string{"token", "schema", "prefix", "valid", "errors"}, validSchemaRule, invalidSchemaRule)
+	if err != nil {
+		return err
+	}
+
 	switch {
 	case len(d.Token) > 0:
-		token := ghtoken.ParseGhToken(d.Token)
-		token.PrintTokenAttributes()
-
-		return nil
+		if err := w.Write(tokenRecord{ghtoken.ParseGhToken(d.Token)}); err != nil {
+			return err //nolint:wrapcheck
+		}
 	case len(d.File) > 0:
-		if err := disectTokensFromFile(d.File); err != nil {
+		if err := disectTokensFromFile(w, d.File); err != nil {
 			return fmt.Errorf("failed inspecting tokens: %w", err)
 		}
-
-		return nil
 	case d.Generated:
-		if err := disectGeneratedTokens(d.Prefix, d.NumTokens); err != nil {
-			return fmt.Errorf("failed inspecting generated tokens: %w", err)
+		gen, err := d.generator()
+		if err != nil {
+			return err
 		}
 
-		return nil
+		if err := disectGeneratedTokens(w, gen, d.Prefix, d.NumTokens); err != nil {
+			return fmt.Errorf("failed inspecting generated tokens: %w", err)
+		}
 	case d.NoAuth:
 		log.Println("[WARNING] the no-auth flag has no effect in this mode, there's no token to inspect!")
 
@@ -47,34 +81,60 @@ func (d *DisectCmd) Run() error {
 
 		return nil
 	}
+
+	return w.Flush() //nolint:wrapcheck
 }
 
-// Print out attributes of tokens in the given file.
-func disectTokensFromFile(file string) error {
+// Report the attributes of tokens in the given file.
+func disectTokensFromFile(w *report.Writer, file string) error {
 	tokens, err := fileutil.ReadLines(file)
 	if err != nil {
 		return fmt.Errorf("failed reading file '%s': %w", file, err)
 	}
 
 	for _, tok := range tokens {
-		token := ghtoken.ParseGhToken(tok)
-		token.PrintTokenAttributes()
+		if err := w.Write(tokenRecord{ghtoken.ParseGhToken(tok)}); err != nil {
+			return err //nolint:wrapcheck
+		}
 	}
 
 	return nil
 }
 
-// Print out attributes of generated tokens.
-func disectGeneratedTokens(prefix string, numTokens uint64) error {
+// Report the attributes of generated tokens.
+func disectGeneratedTokens(w *report.Writer, gen *ghtoken.Generator, prefix string, numTokens uint64) error {
 	if len(prefix) > 0 && !ghtoken.IsValidPrefix(prefix) {
 		return fmt.Errorf("prefix '%s' is not a valid token prefix", prefix)
 	}
 
-	genToken := GenGhTokenFunc(prefix)
+	genToken := GenGhTokenFunc(gen, prefix)
 	for i := uint64(0); i < numTokens; i++ {
-		fake := genToken()
-		fake.PrintTokenAttributes()
+		if err := w.Write(tokenRecord{genToken()}); err != nil {
+			return err //nolint:wrapcheck
+		}
 	}
 
 	return nil
 }
+
+// Row returns the columns of the token.
+func (t tokenRecord) Row() []string {
+	return []string{t.FullToken, t.Schema, t.Prefix, strconv.FormatBool(t.SchemaValid), strings.Join(t.SchemaErrors, "; ")}
+}
+
+// Result returns the token as a SARIF result.
+func (t tokenRecord) Result() report.Result {
+	rule, msg := validSchemaRule, fmt.Sprintf("token '%s' has a valid %s schema", t.FullToken, t.Schema)
+	if !t.SchemaValid {
+		rule, msg = invalidSchemaRule, fmt.Sprintf("token '%s' has an invalid schema: %s", t.FullToken, strings.Join(t.SchemaErrors, "; "))
+	}
+
+	return report.Result{
+		RuleID:              rule.ID,
+		Level:               "",
+		Message:             report.Message{Text: msg},
+		Locations:           nil,
+		PartialFingerprints: nil,
+		Properties:          map[string]any{"schema": t.Schema, "prefix": t.Prefix},
+	}
+}
@@ -0,0 +1,238 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the
+// experiment command.
+package cmds
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pyqlsa/token-forge/internal/analysis"
+	"github.com/pyqlsa/token-forge/internal/odds"
+	"github.com/pyqlsa/token-forge/internal/tokendb"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+const (
+	// experimentSchemaName names the reduced keyspace schema of experiments.
+	experimentSchemaName = "experiment"
+	// experimentPrefix is the prefix of the reduced keyspace schema of
+	// experiments.
+	experimentPrefix = "xpr"
+)
+
+// ExperimentCmd represents the collision experiment cli command.
+type ExperimentCmd struct {
+	Globals
+	Seed       *int64   `help:"Seed for deterministic trials; the same seed always generates the same tokens, and so the same results; if not specified, tokens are generated w/ secure randomness."`
+	Trials     int      `default:"100"                                                                                                                                                                                                                   help:"Number of trials (i.e. local tests) to run for each pair of sizes." short:"k"`
+	NumTests   []uint64 `default:"1000,10000"                                                                                                                                                                                                            help:"Sizes of the test token database to try."                               short:"t"`
+	NumTokens  []uint64 `default:"1000,10000"                                                                                                                                                                                                            help:"Numbers of tokens to test against the database to try."                 short:"n"`
+	Symbols    int      `default:"4"                                                                                                                                                                                                                     help:"Number of random symbols in the payload of the reduced keyspace, i.e. the keyspace holds 62^symbols tokens."`
+	Uniform    bool     `default:"true"                                                                                                                                                                                                                  help:"Generate payloads uniformly over the reduced keyspace, as the predictions assume; w/ --no-uniform, payloads are generated as they are by the other commands, which is not uniform over short payloads." negatable:""`
+	Confidence float64  `default:"0.95"                                                                                                                                                                                                                  help:"Confidence level of the reported intervals; must be greater than 0 and less than 1."`
+}
+
+// experimentCell holds the results of the trials of one pair of sizes.
+type experimentCell struct {
+	tests  uint64
+	tokens uint64
+	trials int
+	// hitTrials is the number of trials in which at least one tested token
+	// was in the database.
+	hitTrials int
+	// hits is the number of tested tokens that were in the database, over
+	// every trial.
+	hits uint64
+	// dupTrials is the number of trials in which the database was populated
+	// w/ at least one duplicate.
+	dupTrials int
+	// predicted and expected hold the sums, over every trial, of the
+	// probability of at least one hit and the expected number of hits; each
+	// trial is predicted w/ the number of distinct tokens it's database
+	// actually holds, since duplicates are skipped while populating.
+	predicted float64
+	expected  float64
+}
+
+// Run the experiment command to check the predicted odds of collisions
+// against repeated local tests.
+func (e *ExperimentCmd) Run() error {
+	switch {
+	case e.Trials < 1:
+		return fmt.Errorf("number of trials must be at least 1")
+	case e.Symbols < 1:
+		return fmt.Errorf("number of symbols must be at least 1")
+	case e.Confidence <= 0 || e.Confidence >= 1:
+		return fmt.Errorf("confidence level must be greater than 0 and less than 1")
+	}
+
+	//nolint:exhaustruct
+	s, err := schema.SchemaConfig{
+		Name:       experimentSchemaName,
+		Prefix:     experimentPrefix,
+		BodyLength: e.Symbols,
+	}.Schema()
+	if err != nil {
+		return fmt.Errorf("failed building reduced keyspace schema: %w", err)
+	}
+
+	if err := schema.Register(s); err != nil {
+		return fmt.Errorf("failed registering reduced keyspace schema: %w", err)
+	}
+
+	gen := e.generator()
+	keyspace := odds.Keyspace(s)
+
+	cells := make([]experimentCell, 0, len(e.NumTests)*len(e.NumTokens))
+	for _, tests := range e.NumTests {
+		for _, tokens := range e.NumTokens {
+			log.Printf("running %d trials w/ %d test tokens and %d tokens to test...", e.Trials, tests, tokens)
+			cell, err := runExperimentCell(gen, keyspace, tests, tokens, e.Trials)
+			if err != nil {
+				return err
+			}
+			cells = append(cells, cell)
+		}
+	}
+
+	return e.print(s, keyspace, cells)
+}
+
+// generator returns the token generator of the experiment.
+func (e *ExperimentCmd) generator() *ghtoken.Generator {
+	opts := make([]ghtoken.GeneratorOption, 0)
+	if e.Uniform {
+		//nolint:exhaustruct
+		opts = append(opts, ghtoken.WithProfile(&ghtoken.Profile{
+			Segments: map[int]ghtoken.SegmentProfile{e.Symbols: ghtoken.UniformSegment(e.Symbols)},
+		}))
+	}
+
+	if e.Seed == nil {
+		return ghtoken.NewGenerator(datautil.NewSecureRand(), opts...)
+	}
+
+	return ghtoken.NewSeededGenerator(*e.Seed, opts...)
+}
+
+// Run the trials of one pair of sizes; trials run sequentially, w/o the
+// concurrency and progress of the local command, so a seeded experiment is
+// reproducible.
+func runExperimentCell(gen *ghtoken.Generator, keyspace *big.Int, tests, tokens uint64, trials int) (experimentCell, error) {
+	//nolint:exhaustruct
+	cell := experimentCell{tests: tests, tokens: tokens, trials: trials}
+	genToken := GenGhTokenFunc(gen, experimentPrefix)
+	draws := new(big.Int).SetUint64(tokens)
+
+	for i := 0; i < trials; i++ {
+		//nolint:exhaustruct
+		db, err := tokendb.New(tokendb.Options{Shards: 1, Capacity: tests, Prefixes: []string{experimentPrefix}})
+		if err != nil {
+			return cell, fmt.Errorf("failed creating test token database: %w", err)
+		}
+
+		dup := false
+		for j := uint64(0); j < tests; j++ {
+			added, err := db.Add(genToken().FullToken)
+			if err != nil {
+				return cell, fmt.Errorf("failed adding test token: %w", err)
+			}
+			dup = dup || !added
+		}
+
+		hits := uint64(0)
+		for j := uint64(0); j < tokens; j++ {
+			if db.Contains(genToken().FullToken) {
+				hits++
+			}
+		}
+
+		if dup {
+			cell.dupTrials++
+		}
+		if hits > 0 {
+			cell.hitTrials++
+		}
+		cell.hits += hits
+
+		calc := odds.New(keyspace, new(big.Int).SetUint64(db.Len()), draws)
+		predicted, _ := calc.Exact().Float64()
+		expected, _ := calc.Expected().Float64()
+		cell.predicted += predicted
+		cell.expected += expected
+	}
+
+	return cell, nil
+}
+
+// Print the results of the experiment.
+func (e *ExperimentCmd) print(s schema.Schema, keyspace *big.Int, cells []experimentCell) error {
+	generation := "uniform"
+	if !e.Uniform {
+		generation = "uncalibrated"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintf(w, "schema:\t%s (%s)\n", s.Name, s.Prefix)
+	fmt.Fprintf(w, "keyspace (K):\t%d^%d = %s\n", len(s.Alphabet), odds.RandomSymbols(s), formatInt(keyspace))
+	fmt.Fprintf(w, "generation:\t%s\n", generation)
+	fmt.Fprintf(w, "trials:\t%d per pair of sizes, w/ %g%% confidence intervals\n", e.Trials, 100*e.Confidence) //nolint:gomnd
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "tested tokens in the database:")
+	fmt.Fprintln(w, "test tokens (N)\ttokens tested (M)\tP(hit)\tinterval\tpredicted\tagrees\thits per trial\texpected")
+	for _, c := range cells {
+		observed := float64(c.hitTrials) / float64(c.trials)
+		interval := analysis.Wilson(c.hitTrials, c.trials, e.Confidence)
+		predicted := c.predicted / float64(c.trials)
+		fmt.Fprintf(w, "%d\t%d\t%.4f\t%s\t%.4f\t%s\t%.4f\t%.4f\n",
+			c.tests, c.tokens, observed, formatInterval(interval), predicted, formatAgrees(interval, predicted),
+			float64(c.hits)/float64(c.trials), c.expected/float64(c.trials))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "duplicates while populating the database (birthday problem):")
+	fmt.Fprintln(w, "test tokens (N)\tP(duplicate)\tinterval\tpredicted\tagrees")
+	for _, tests := range e.NumTests {
+		// the database is populated the same way regardless of the number of
+		// tokens tested, so the trials of every cell of a size are pooled.
+		dups, trials := 0, 0
+		for _, c := range cells {
+			if c.tests == tests {
+				dups += c.dupTrials
+				trials += c.trials
+			}
+		}
+		observed := float64(dups) / float64(trials)
+		interval := analysis.Wilson(dups, trials, e.Confidence)
+		predicted, _ := odds.New(keyspace, new(big.Int).SetUint64(tests), big.NewInt(0)).Birthday().Float64()
+		fmt.Fprintf(w, "%d\t%.4f\t%s\t%.4f\t%s\n",
+			tests, observed, formatInterval(interval), predicted, formatAgrees(interval, predicted))
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed printing experiment results: %w", err)
+	}
+
+	return nil
+}
+
+// Format a confidence interval.
+func formatInterval(i analysis.Interval) string {
+	return fmt.Sprintf("[%.4f, %.4f]", i.Low, i.High)
+}
+
+// Format whether or not a prediction is inside a confidence interval.
+func formatAgrees(i analysis.Interval, predicted float64) string {
+	if i.Contains(predicted) {
+		return "yes"
+	}
+
+	return "no"
+}
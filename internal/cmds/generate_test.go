@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/pyqlsa/token-forge/internal/cmds"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,6 +33,15 @@ func TestGenerateTokens(t *testing.T) {
 		{
 			prefix: "ghs", validPrefix: true, validSchema: true, validChecksum: true,
 		},
+		{
+			prefix: "ghr", validPrefix: true, validSchema: true, validChecksum: true,
+		},
+		{
+			prefix: "github_pat", validPrefix: true, validSchema: true, validChecksum: true,
+		},
+		{
+			prefix: "npm", validPrefix: true, validSchema: true, validChecksum: true,
+		},
 		{
 			prefix: "a", validPrefix: false, validSchema: false, validChecksum: true,
 		},
@@ -49,7 +60,7 @@ func TestGenerateTokens(t *testing.T) {
 		t.Run(tc.prefix, func(t *testing.T) {
 			t.Parallel()
 			numTokens := uint64(10000)
-			genToken := cmds.GenGhTokenFunc(tc.prefix)
+			genToken := cmds.GenGhTokenFunc(ghtoken.NewGenerator(datautil.NewSecureRand()), tc.prefix)
 			for i := uint64(0); i < numTokens; i++ {
 				fake := genToken()
 				assert.Equal(t, fake.HasValidChecksum(), tc.validChecksum, "generated token with invalid checksum: %s", fake.FullToken)
@@ -61,3 +72,23 @@ func TestGenerateTokens(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateSeeded(t *testing.T) {
+	t.Parallel()
+	for _, prefix := range []string{"", "ghp", "github_pat"} {
+		prefix := prefix // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(prefix, func(t *testing.T) {
+			t.Parallel()
+			first := cmds.GenGhTokenFunc(ghtoken.NewSeededGenerator(42), prefix)
+			second := cmds.GenGhTokenFunc(ghtoken.NewSeededGenerator(42), prefix)
+			other := cmds.GenGhTokenFunc(ghtoken.NewSeededGenerator(43), prefix)
+			differ := false
+			for i := 0; i < 100; i++ {
+				tok := first().FullToken
+				assert.Equal(t, tok, second().FullToken, "same seed generated different tokens")
+				differ = differ || tok != other().FullToken
+			}
+			assert.True(t, differ, "different seeds generated the same tokens")
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the
+// install-hook command.
+package cmds
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker marks pre-commit hooks written by the install-hook command, so
+// they can be replaced w/o --force.
+const hookMarker = "# installed by token-forge install-hook"
+
+// InstallHookCmd represents the install pre-commit hook cli command.
+type InstallHookCmd struct {
+	Globals
+	SchemaArgs
+	Repo       string `arg:""                                                                                                                                 default:"."         help:"Path to the git repository to install the hook in." type:"existingdir"`
+	Force      bool   `help:"Replace an existing pre-commit hook that wasn't installed by token-forge."                                                       short:"f"`
+	Executable string `help:"Path to the token-forge executable the hook runs; defaults to this executable, unless it's a temporary build, e.g. of 'go run'." type:"existingfile"`
+}
+
+// Run the install-hook command to install a pre-commit hook that scans the
+// staged changes of every commit, blocking commits that add tokens w/ a valid
+// checksum.
+func (i *InstallHookCmd) Run() error {
+	exe, err := i.executable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{shellQuote(exe), "scan", "--staged"}
+	if len(i.SchemaFile) > 0 {
+		schemaFile, err := filepath.Abs(i.SchemaFile)
+		if err != nil {
+			return fmt.Errorf("failed resolving schema file: %w", err)
+		}
+		args = append(args, "--schema-file", shellQuote(schemaFile))
+	}
+
+	hooks, err := hooksDir(i.Repo)
+	if err != nil {
+		return err
+	}
+	hook := filepath.Join(hooks, "pre-commit")
+
+	existing, err := os.ReadFile(hook) //#nosec:G304
+	switch {
+	case err == nil && !bytes.Contains(existing, []byte(hookMarker)) && !i.Force:
+		return fmt.Errorf("a pre-commit hook already exists at '%s'; use --force to replace it", hook)
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("failed reading existing pre-commit hook: %w", err)
+	}
+
+	script := strings.Join([]string{
+		"#!/bin/sh",
+		hookMarker,
+		"# blocks commits that add GitHub tokens w/ a valid checksum; bypass w/ 'git commit --no-verify'.",
+		"exec " + strings.Join(args, " "),
+		"",
+	}, "\n")
+
+	if err := os.MkdirAll(hooks, 0o755); err != nil { //nolint:gomnd
+		return fmt.Errorf("failed creating hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hook, []byte(script), 0o755); err != nil { //#nosec:G306 //nolint:gomnd
+		return fmt.Errorf("failed writing pre-commit hook: %w", err)
+	}
+	// WriteFile only sets the mode of new files.
+	if err := os.Chmod(hook, 0o755); err != nil { //#nosec:G302 //nolint:gomnd
+		return fmt.Errorf("failed making pre-commit hook executable: %w", err)
+	}
+
+	log.Printf("installed pre-commit hook at '%s'", hook)
+
+	return nil
+}
+
+// Return the absolute path of the token-forge executable the hook runs; a
+// temporary build (e.g. of 'go run') is rejected, since it's removed once it
+// exits, leaving the hook to fail every commit.
+func (i *InstallHookCmd) executable() (string, error) {
+	if len(i.Executable) > 0 {
+		exe, err := filepath.Abs(i.Executable)
+		if err != nil {
+			return "", fmt.Errorf("failed resolving executable: %w", err)
+		}
+
+		return exe, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed finding the token-forge executable: %w", err)
+	}
+	if underDir(exe, os.TempDir()) {
+		return "", fmt.Errorf("the token-forge executable '%s' is a temporary build, which the hook would outlive; "+
+			"install token-forge (e.g. w/ 'go install'), or give it's path w/ --executable", exe)
+	}
+
+	return exe, nil
+}
+
+// Return whether or not the given path is under the given directory, once
+// symlinks are resolved (e.g. the temporary directory of macOS is a symlink).
+func underDir(path, dir string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Return the hooks directory of the given repository, honoring core.hooksPath,
+// and worktrees.
+func hooksDir(repo string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", repo, "rev-parse", "--git-path", "hooks") //#nosec:G204
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed finding hooks directory: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	hooks := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(repo, hooks)
+	}
+
+	return hooks, nil
+}
+
+// Quote the given string for a posix shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,129 @@
+// Package cmds_test provides tests for the cmds package.
+package cmds_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/internal/cmds"
+	"github.com/stretchr/testify/assert"
+)
+
+// gitInit initializes a git repository in a new temporary directory, w/ the
+// given config, and returns it's path.
+func gitInit(t *testing.T, config ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	repo := t.TempDir()
+	args := [][]string{{"init", "-q"}}
+	for i := 0; i+1 < len(config); i += 2 {
+		args = append(args, []string{"config", config[i], config[i+1]})
+	}
+	for _, a := range args {
+		out, err := exec.Command("git", append([]string{"-C", repo}, a...)...).CombinedOutput() //#nosec:G204
+		if !assert.NoError(t, err, "git %v: %s", a, out) {
+			t.FailNow()
+		}
+	}
+
+	return repo
+}
+
+func TestInstallHook(t *testing.T) {
+	t.Parallel()
+	exe := filepath.Join(t.TempDir(), "it's token-forge")
+	if !assert.NoError(t, os.WriteFile(exe, nil, 0o700)) {
+		t.FailNow()
+	}
+	const foreign = "#!/bin/sh\nexit 0\n"
+
+	testcases := []struct {
+		name     string
+		config   []string
+		existing string
+		force    bool
+		hook     string
+		err      bool
+	}{
+		{name: "new", config: nil, existing: "", force: false, hook: ".git/hooks/pre-commit", err: false},
+		{name: "foreign hook", config: nil, existing: foreign, force: false, hook: ".git/hooks/pre-commit", err: true},
+		{name: "foreign hook w/ force", config: nil, existing: foreign, force: true, hook: ".git/hooks/pre-commit", err: false},
+		{
+			name: "marked hook", config: nil, existing: "#!/bin/sh\n# installed by token-forge install-hook\nexec old\n",
+			force: false, hook: ".git/hooks/pre-commit", err: false,
+		},
+		{name: "hooks path", config: []string{"core.hooksPath", "custom/hooks"}, existing: "", force: false, hook: "custom/hooks/pre-commit", err: false},
+		{name: "foreign hook in hooks path", config: []string{"core.hooksPath", "custom/hooks"}, existing: foreign, force: false, hook: "custom/hooks/pre-commit", err: true},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			repo := gitInit(t, tc.config...)
+			hook := filepath.Join(repo, tc.hook)
+			if len(tc.existing) > 0 {
+				if !assert.NoError(t, os.MkdirAll(filepath.Dir(hook), 0o700)) ||
+					!assert.NoError(t, os.WriteFile(hook, []byte(tc.existing), 0o600)) {
+					t.FailNow()
+				}
+			}
+
+			//nolint:exhaustruct
+			cmd := cmds.InstallHookCmd{Repo: repo, Force: tc.force, Executable: exe}
+			err := cmd.Run()
+			script, rerr := os.ReadFile(hook)
+			if !assert.NoError(t, rerr) {
+				t.FailNow()
+			}
+			if tc.err {
+				assert.Error(t, err, "expected a foreign hook not to be replaced w/o --force")
+				assert.Equal(t, tc.existing, string(script), "expected a foreign hook to be left alone")
+
+				return
+			}
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Contains(t, string(script), "# installed by token-forge install-hook", "expected the hook to be marked")
+			assert.NotContains(t, string(script), "exec old", "expected the existing hook to be replaced")
+			assert.Contains(t, string(script), `exec '`+strings.ReplaceAll(exe, "'", `'\''`)+`' scan --staged`, "expected the hook to run the executable")
+			info, err := os.Stat(hook)
+			if assert.NoError(t, err) {
+				assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "expected the hook to be executable")
+			}
+		})
+	}
+}
+
+func TestInstallHookTemporaryExecutable(t *testing.T) {
+	t.Parallel()
+	exe, err := os.Executable()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tmp, err := filepath.EvalSymlinks(os.TempDir())
+	if err != nil {
+		tmp = os.TempDir()
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if !strings.HasPrefix(exe, tmp+string(filepath.Separator)) {
+		t.Skip("test binary isn't a temporary build")
+	}
+
+	// the test binary is a temporary build, as a 'go run' binary is.
+	repo := gitInit(t)
+	cmd := cmds.InstallHookCmd{Repo: repo} //nolint:exhaustruct
+	err = cmd.Run()
+	if assert.Error(t, err, "expected a temporary executable to be rejected") {
+		assert.Contains(t, err.Error(), "--executable")
+	}
+	assert.NoFileExists(t, filepath.Join(repo, ".git", "hooks", "pre-commit"))
+}
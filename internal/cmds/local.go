@@ -4,40 +4,174 @@
 package cmds
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"sync"
 	"sync/atomic"
 
 	"github.com/pyqlsa/token-forge/internal/bar"
-	"github.com/pyqlsa/token-forge/internal/ghtoken"
+	"github.com/pyqlsa/token-forge/internal/tokendb"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
 )
 
 // LocalCmd represents the local collision test cli command.
 type LocalCmd struct {
 	Globals
 	TokenParams
+	GeneratorArgs
+	SchemaArgs
+	SimulationArgs
+	DatabaseArgs
+	CheckpointArgs
 	NumTests uint64 `default:"1" help:"Number of tokens to load into the test token database." short:"t"`
 }
 
-type tokenDB map[string]bool
+// DatabaseArgs represents parameters for the test token database.
+type DatabaseArgs struct {
+	Workers   int     `default:"0"      group:"Database"                                                                                             help:"Number of concurrent workers loading, and testing against, the test token database; 0 uses one per cpu."`
+	Shards    int     `default:"64"     group:"Database"                                                                                             help:"Number of independently locked shards of the test token database."`
+	BloomFPR  float64 `default:"0"      group:"Database"                                                                                             help:"False positive rate of a bloom filter tier in front of the test token database; 0 disables the tier."`
+	BloomOnly bool    `group:"Database" help:"Keep only the bloom filter tier of the test token database, in a fraction of the memory; collisions may then be false positives, at the bloom filter's false positive rate."`
+	Save      string  `group:"Database" help:"Save the populated test token database to the given file, to be loaded by later runs."                 type:"path"         xor:"dbfile"`
+	Load      string  `group:"Database" help:"Load the test token database from the given file, saved by an earlier run, rather than populating it." type:"existingfile" xor:"dbfile"`
+}
 
-func newtokenDB() tokenDB {
-	return make(map[string]bool)
+// tokenLookup is a test token database that tokens are looked up in.
+type tokenLookup interface {
+	Contains(tok string) bool
+}
+
+// newDB returns an empty test token database, sized to hold the given number
+// of tokens w/ the given prefix, or w/ any registered prefix if the prefix is
+// empty.
+func (a DatabaseArgs) newDB(num uint64, prefix string) (*tokendb.DB, error) {
+	if a.BloomOnly && len(a.Save) > 0 {
+		return nil, fmt.Errorf("a bloom filter only test token database can't be saved")
+	}
+
+	prefixes := ghtoken.GetValidPrefixes()
+	if len(prefix) > 0 {
+		prefixes = []string{prefix}
+	}
+
+	db, err := tokendb.New(tokendb.Options{
+		Shards:    a.Shards,
+		Capacity:  num,
+		Prefixes:  prefixes,
+		BloomFPR:  a.BloomFPR,
+		BloomOnly: a.BloomOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating test token database: %w", err)
+	}
+
+	return db, nil
 }
 
 // Run the generate tokens command to generate GitHub-like tokens.
 func (d *LocalCmd) Run() error {
+	var state *checkpointState
+	if len(d.Resume) > 0 {
+		var err error
+		if state, err = d.resume(); err != nil {
+			return err
+		}
+	}
+
+	if err := loadSchemaFile(d.SchemaFile); err != nil {
+		return err
+	}
+
 	if len(d.Prefix) > 0 && !ghtoken.IsValidPrefix(d.Prefix) {
 		return fmt.Errorf("prefix '%s' is not a valid token prefix", d.Prefix)
 	}
 
-	db := newtokenDB()
-	genToken := GenGhTokenFunc(d.Prefix)
-	log.Printf("loading %d tokens...", d.NumTests)
-	db.populate(d.NumTests, genToken)
+	if d.Duration > 0 {
+		if err := d.checkSimulation(); err != nil {
+			return err
+		}
+
+		gen, err := d.generator()
+		if err != nil {
+			return err
+		}
+
+		return d.simulate(gen)
+	}
+
+	if d.BatchSize < 1 {
+		return fmt.Errorf("must specify a batch size of 1 or greater")
+	}
+
+	if d.Workers < 1 {
+		d.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	if state == nil && len(d.Checkpoint) > 0 {
+		var err error
+		if state, err = d.newCheckpointState(); err != nil {
+			return err
+		}
+	}
+
+	var db tokenLookup
+	if len(d.Load) > 0 {
+		file, err := d.open()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); cerr != nil {
+				log.Printf("error closing test token database: %v", cerr)
+			}
+		}()
+		db = file
+	} else {
+		mem, err := d.newDB(d.NumTests, d.Prefix)
+		if err != nil {
+			return err
+		}
+		if err := d.populate(mem); err != nil {
+			return err
+		}
+		db = mem
+	}
+
+	newGen, err := d.batchGenerators()
+	if err != nil {
+		return err
+	}
 
-	collisions, err := db.testCollisions(generatedTokenSource(d.Prefix, d.NumTokens), d.BatchSize)
+	source := generatedTokenSource(newGen, d.Prefix, d.NumTokens, uint64(d.BatchSize))
+	var ckpt *checkpointer
+	var done func(batch uint64, collisions []string)
+	if state != nil {
+		if state.Batches > 0 {
+			log.Printf("resuming after %d tokens tested w/ %d collisions", state.Tested, len(state.Collisions))
+		}
+		source.skip(state.Batches)
+		ckpt = newCheckpointer(d.Checkpoint, d.CheckpointInterval, state)
+		done = ckpt.done
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	collisions, err := testCollisions(ctx, db, source, d.Workers, done)
+	if ckpt != nil {
+		if serr := ckpt.save(); serr != nil {
+			return serr
+		}
+		collisions = uint64(len(state.Collisions))
+		if err != nil {
+			log.Printf("saved progress after %d tokens tested; resume w/ --resume %s", state.Tested, d.Checkpoint)
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -46,74 +180,238 @@ func (d *LocalCmd) Run() error {
 	return nil
 }
 
-func (db tokenDB) populate(num uint64, genToken func() *ghtoken.GhToken) {
-	for i := uint64(0); i < num; i++ {
-		fake := genToken()
-		if _, exist := db[fake.FullToken]; !exist {
-			// safe to add fresh token
-			db[fake.FullToken] = true
-		} else {
-			log.Printf("observed token collision while generating test set for token: %s", fake.FullToken)
+// resume takes the parameters of the test from the state file, returning the
+// saved progress; it's progress keeps being saved to the same file, unless
+// another is given.
+func (d *LocalCmd) resume() (*checkpointState, error) {
+	state, err := readCheckpoint(d.Resume)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Checkpoint) < 1 {
+		d.Checkpoint = d.Resume
+	}
+	d.Seed, d.Profile, d.SchemaFile = state.Seed, state.Profile, state.SchemaFile
+	d.Prefix, d.BatchSize, d.NumTokens = state.Prefix, state.BatchSize, state.NumTokens
+	d.Load, d.Save = state.Database.File, ""
+	d.NumTests, d.Workers = state.Database.NumTests, state.Database.Workers
+	d.BloomFPR, d.BloomOnly = state.Database.BloomFPR, state.Database.BloomOnly
+
+	if d.Seed == nil {
+		log.Printf("resuming a test w/o a seed; the remaining tokens are generated w/ fresh secure randomness")
+	}
+
+	return state, nil
+}
+
+// newCheckpointState returns the state of a test that hasn't started yet; the
+// test token database must be either saved or seeded, so that it is the same
+// when the test is resumed.
+func (d *LocalCmd) newCheckpointState() (*checkpointState, error) {
+	file := d.Load
+	if len(d.Save) > 0 {
+		file = d.Save
+	}
+
+	if len(file) < 1 && d.Seed == nil {
+		return nil, fmt.Errorf("a test token database generated w/ secure randomness must be saved (see --save) to be checkpointed")
+	}
+
+	if len(file) > 0 {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed resolving test token database path: %w", err)
 		}
+		file = abs
 	}
+
+	return &checkpointState{
+		Seed:       d.Seed,
+		Profile:    d.Profile,
+		SchemaFile: d.SchemaFile,
+		Prefix:     d.Prefix,
+		BatchSize:  d.BatchSize,
+		NumTokens:  d.NumTokens,
+		Batches:    0,
+		Tested:     0,
+		Collisions: []string{},
+		Database: checkpointDatabase{
+			File:      file,
+			NumTests:  d.NumTests,
+			Workers:   d.Workers,
+			BloomFPR:  d.BloomFPR,
+			BloomOnly: d.BloomOnly,
+		},
+	}, nil
 }
 
-func (db tokenDB) testCollisions(source tokenSource, batchSize int) (int32, error) {
-	log.Printf("testing w/ %d tokens", source.remaining())
-	numCollisions := int32(0)
-	tokensLeft := source.remaining()
+// simulate runs the time-aware local collision test.
+func (d *LocalCmd) simulate(gen *ghtoken.Generator) error {
+	sim, err := d.newSimulation(gen)
+	if err != nil {
+		return err
+	}
+
+	if err := sim.run(d.Duration, d.NumTokens, d.Prefix); err != nil {
+		return err
+	}
+
+	hits, expired := sim.collisions()
+	log.Printf("test complete with %d collisions against live tokens (and %d against expired tokens)", hits, expired)
+
+	return sim.print(d.Duration)
+}
+
+// checkSimulation returns an error if any flag of the static test token
+// database is set along w/ --duration, since a time-aware simulation would
+// ignore it.
+func (d *LocalCmd) checkSimulation() error {
+	if len(d.Checkpoint) > 0 || len(d.Resume) > 0 {
+		return fmt.Errorf("a time-aware simulation can't be checkpointed")
+	}
+
+	ignored := []struct {
+		flag string
+		set  bool
+	}{
+		{flag: "--load", set: len(d.Load) > 0},
+		{flag: "--save", set: len(d.Save) > 0},
+		{flag: "--num-tests", set: d.NumTests != 1},
+		{flag: "--workers", set: d.Workers != 0},
+		{flag: "--bloom-fpr", set: d.BloomFPR != 0},
+		{flag: "--bloom-only", set: d.BloomOnly},
+	}
+	for _, f := range ignored {
+		if f.set {
+			return fmt.Errorf("%s can't be used w/ a time-aware simulation (--duration), which issues it's own tokens", f.flag)
+		}
+	}
+
+	return nil
+}
+
+// populate loads the test token database in parallel, w/ a generator for
+// each worker.
+func (d *LocalCmd) populate(db *tokendb.DB) error {
+	gens, err := d.generators(d.Workers)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("loading %d tokens w/ %d workers...", d.NumTests, d.Workers)
+	dups, err := db.Load(d.NumTests, d.Workers, func(worker int) func() string {
+		genToken := GenGhTokenFunc(gens[worker], d.Prefix)
+
+		return func() string {
+			return genToken().FullToken
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed loading test token database: %w", err)
+	}
+
+	if dups > 0 {
+		log.Printf("observed %d token collisions while generating test set", dups)
+	}
+	log.Printf("loaded %d tokens into %d MiB", db.Len(), db.Bytes()>>20) //nolint:gomnd
+
+	if len(d.Save) > 0 {
+		profile, err := d.profile()
+		if err != nil {
+			return err
+		}
+		//nolint:exhaustruct
+		if err := db.SaveFile(d.Save, tokendb.Header{Seed: d.Seed, Workers: d.Workers, Profile: profile.Fingerprint()}); err != nil {
+			return fmt.Errorf("failed saving test token database: %w", err)
+		}
+		log.Printf("saved test token database to %s", d.Save)
+	}
+
+	return nil
+}
+
+// open opens the saved test token database, in place of populating one; the
+// database must have been generated w/ the same calibration profile as the
+// tokens tested against it.
+func (d *LocalCmd) open() (*tokendb.File, error) {
+	profile, err := d.profile()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := tokendb.Open(d.Load)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading test token database: %w", err)
+	}
+
+	if err := file.Header.CheckProfile(profile.Fingerprint()); err != nil {
+		if cerr := file.Close(); cerr != nil {
+			log.Printf("error closing test token database: %v", cerr)
+		}
+
+		return nil, fmt.Errorf("failed loading test token database: %w", err)
+	}
+
+	prefixes := make([]string, 0, len(file.Header.Sets))
+	for _, set := range file.Header.Sets {
+		prefixes = append(prefixes, set.Schema.Prefix)
+	}
+	seed := "none"
+	if file.Header.Seed != nil {
+		seed = fmt.Sprintf("%d (w/ %d workers)", *file.Header.Seed, file.Header.Workers)
+	}
+	log.Printf("loaded %d tokens w/ prefixes %v from %s; seed: %s", file.Len(), prefixes, d.Load, seed)
+
+	return file, nil
+}
+
+// testCollisions tests every token of the source against the test token
+// database w/ the given number of concurrent workers, each pulling batches
+// from the source until it's drained or the context is done, returning the
+// number of collisions; if done isn't nil, it is called w/ the index and
+// collisions of each batch that's been tested.
+func testCollisions(ctx context.Context, db tokenLookup, source tokenSource, workers int, done func(batch uint64, collisions []string)) (uint64, error) {
+	log.Printf("testing w/ %d tokens w/ %d workers", source.remaining(), workers)
+	var numCollisions atomic.Uint64
 	progress := bar.NewBar(source.remaining())
 	wg := sync.WaitGroup{}
-	// kick off the initial batch of workers
-	for !source.done() && batchSize > 0 && tokensLeft > 0 {
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		// it's slightly faster to do this in the main thread
-		token, err := source.pop()
-		if err != nil {
-			return numCollisions, fmt.Errorf("error popping token: %w", err)
-		}
 		go func() {
-			if _, exist := db[token.FullToken]; exist {
-				atomic.AddInt32(&numCollisions, 1)
-				log.Printf("!!! collision: %s", token.FullToken)
+			defer wg.Done()
+			var buf []*ghtoken.GhToken
+			for ctx.Err() == nil {
+				var batch uint64
+				if buf, batch = source.next(buf[:0]); len(buf) < 1 {
+					return
+				}
+
+				found := []string{}
+				for _, token := range buf {
+					if db.Contains(token.FullToken) {
+						numCollisions.Add(1)
+						found = append(found, token.FullToken)
+						log.Printf("!!! collision: %s", token.FullToken)
+					}
+				}
+				if done != nil {
+					done(batch, found)
+				}
+				if err := progress.Add(len(buf)); err != nil {
+					log.Printf("error adding to the progressbar? %v", err)
+				}
 			}
-			wg.Done()
 		}()
-		tokensLeft--
-		batchSize--
-		if err := progress.Inc(); err != nil {
-			log.Printf("error adding to the progressbar? %v", err)
-		}
-	}
-
-	for tokensLeft > 0 {
-		// as we're gathering results and the source hasn't been drained, kick off
-		// new workers; this makes sure that concurrent workers aren't entirely
-		// unbounded
-		if !source.done() {
-			wg.Add(1)
-			// it's slightly faster to do this in the main thread
-			token, err := source.pop()
-			if err != nil {
-				return numCollisions, fmt.Errorf("error popping token: %w", err)
-			}
-			go func() {
-				if _, exist := db[token.FullToken]; exist {
-					atomic.AddInt32(&numCollisions, 1)
-					log.Printf("!!! collision: %s", token.FullToken)
-				}
-				wg.Done()
-			}()
-		}
-		tokensLeft--
-		if err := progress.Inc(); err != nil {
-			log.Printf("error adding to the progressbar? %v", err)
-		}
 	}
 	wg.Wait()
 	if err := progress.Finish(); err != nil {
 		log.Printf("error finishing the progressbar? %v", err)
 	}
 
-	return numCollisions, nil
+	if err := ctx.Err(); err != nil {
+		return numCollisions.Load(), fmt.Errorf("test interrupted: %w", err)
+	}
+
+	return numCollisions.Load(), nil
 }
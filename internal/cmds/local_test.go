@@ -0,0 +1,147 @@
+// Package cmds_test provides tests for the cmds package.
+package cmds_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/bar"
+	"github.com/pyqlsa/token-forge/internal/cmds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCheckpoint(t *testing.T) {
+	t.Parallel()
+	seed := int64(1)
+	state := filepath.Join(t.TempDir(), "state.json")
+	//nolint:exhaustruct
+	cmd := cmds.LocalCmd{
+		TokenParams:    cmds.TokenParams{BatchSize: 100, NumTokens: 1050, Prefix: "ghp"},
+		GeneratorArgs:  cmds.GeneratorArgs{Seed: &seed},
+		DatabaseArgs:   cmds.DatabaseArgs{Workers: 2, Shards: 1},
+		CheckpointArgs: cmds.CheckpointArgs{Checkpoint: state, CheckpointInterval: 0},
+		NumTests:       100,
+	}
+	if !assert.NoError(t, cmd.Run()) {
+		t.FailNow()
+	}
+
+	read := func() map[string]any {
+		data, err := os.ReadFile(state)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		var saved map[string]any
+		if !assert.NoError(t, json.Unmarshal(data, &saved)) {
+			t.FailNow()
+		}
+
+		return saved
+	}
+	saved := read()
+	assert.EqualValues(t, 1050, saved["tested"])
+	assert.EqualValues(t, 11, saved["batches"], "every batch, including the short last one, should be tested")
+	assert.EqualValues(t, 1, saved["seed"])
+
+	// rewind the saved progress, w/ a collision found before the interruption;
+	// resuming tests the remaining batches, and keeps the earlier collision.
+	saved["batches"], saved["tested"], saved["collisions"] = 4, 400, []string{"ghp_earlier"}
+	data, err := json.Marshal(saved)
+	if !assert.NoError(t, err) || !assert.NoError(t, os.WriteFile(state, data, 0o600)) {
+		t.FailNow()
+	}
+
+	//nolint:exhaustruct
+	resumed := cmds.LocalCmd{CheckpointArgs: cmds.CheckpointArgs{Resume: state}}
+	if !assert.NoError(t, resumed.Run()) {
+		t.FailNow()
+	}
+	assert.Equal(t, uint64(1050), resumed.NumTokens, "parameters should be taken from the state file")
+	saved = read()
+	assert.EqualValues(t, 1050, saved["tested"])
+	assert.Equal(t, []any{"ghp_earlier"}, saved["collisions"])
+}
+
+func TestLocalSimulationFlags(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		name string
+		args func(cmd *cmds.LocalCmd)
+	}{
+		{name: "checkpoint", args: func(cmd *cmds.LocalCmd) { cmd.Checkpoint = "state.json" }},
+		{name: "load", args: func(cmd *cmds.LocalCmd) { cmd.Load = "tokens.db" }},
+		{name: "save", args: func(cmd *cmds.LocalCmd) { cmd.Save = "tokens.db" }},
+		{name: "num-tests", args: func(cmd *cmds.LocalCmd) { cmd.NumTests = 10 }},
+		{name: "workers", args: func(cmd *cmds.LocalCmd) { cmd.Workers = 2 }},
+		{name: "bloom-fpr", args: func(cmd *cmds.LocalCmd) { cmd.BloomFPR = 0.01 }},
+		{name: "bloom-only", args: func(cmd *cmds.LocalCmd) { cmd.BloomOnly = true }},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			//nolint:exhaustruct
+			cmd := cmds.LocalCmd{
+				TokenParams:    cmds.TokenParams{BatchSize: 100, NumTokens: 10, Prefix: "ghp"},
+				SimulationArgs: cmds.SimulationArgs{Duration: time.Hour, Rates: map[string]float64{"ghp": 10}},
+				NumTests:       1,
+			}
+			tc.args(&cmd)
+			err := cmd.Run()
+			if assert.Error(t, err, "expected a usage error") {
+				assert.Contains(t, err.Error(), tc.name)
+			}
+		})
+	}
+}
+
+// BenchmarkLocal measures the throughput of testing tokens against the test
+// token database w/ an increasing number of workers, up to one per cpu; the
+// tokens/s of each should scale linearly w/ it's workers. The database is
+// populated and saved once, outside of the timer, and loaded by each run.
+func BenchmarkLocal(b *testing.B) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	bar.SetOutput(io.Discard)
+	defer func() {
+		log.SetOutput(out)
+		bar.SetOutput(os.Stderr)
+	}()
+
+	seed := int64(1)
+	saved := filepath.Join(b.TempDir(), "tokens.db")
+	//nolint:exhaustruct
+	populate := cmds.LocalCmd{
+		TokenParams:   cmds.TokenParams{BatchSize: 1000, NumTokens: 0, Prefix: "ghp"},
+		GeneratorArgs: cmds.GeneratorArgs{Seed: &seed},
+		DatabaseArgs:  cmds.DatabaseArgs{Workers: 1, Shards: 64, Save: saved},
+		NumTests:      1000,
+	}
+	if err := populate.Run(); err != nil {
+		b.Fatal(err)
+	}
+
+	for workers := 1; workers <= runtime.GOMAXPROCS(0); workers <<= 1 {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			//nolint:exhaustruct
+			cmd := cmds.LocalCmd{
+				TokenParams:   cmds.TokenParams{BatchSize: 1000, NumTokens: uint64(b.N), Prefix: "ghp"},
+				GeneratorArgs: cmds.GeneratorArgs{Seed: &seed},
+				DatabaseArgs:  cmds.DatabaseArgs{Workers: workers, Shards: 64, Load: saved},
+				NumTests:      1000,
+			}
+			b.ResetTimer()
+			if err := cmd.Run(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "tokens/s")
+		})
+	}
+}
@@ -9,14 +9,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/go-github/v61/github"
 	"github.com/pyqlsa/token-forge/internal/bar"
 	"github.com/pyqlsa/token-forge/internal/fileutil"
-	"github.com/pyqlsa/token-forge/internal/ghtoken"
+	"github.com/pyqlsa/token-forge/internal/report"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
 	"golang.org/x/oauth2"
 )
 
@@ -31,11 +32,28 @@ type LoginCmd struct {
 	Globals
 	TokenSourceArgs
 	TokenParams
+	GeneratorArgs
+	SchemaArgs
 	ProxyConfig
 	ForceCheck bool   `help:"Force a check of the logged in user so the rate limit is decremented."                     short:"c"`
 	Host       string `help:"The GitHub Enterprise hostname to interact with; if not specified, github.com is assumed."`
+	Format     string `default:"json"                                                                                   enum:"table,json,jsonl,csv,sarif" help:"Format of the checked users: table, json, jsonl, csv, or sarif." short:"o"`
 }
 
+// Rules that checked users are reported under, in SARIF reports.
+var (
+	loginUserRule = report.Rule{
+		ID:                   "login-user",
+		ShortDescription:     report.Message{Text: "Token logged in as a user"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelError},
+	}
+	loginFailedRule = report.Rule{
+		ID:                   "login-failed",
+		ShortDescription:     report.Message{Text: "Token failed to log in as a user"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelNote},
+	}
+)
+
 // GhUserInfo holds GitHub user information along with the token used to get
 // the information.
 type GhUserInfo struct {
@@ -43,44 +61,61 @@ type GhUserInfo struct {
 	Info  *github.User     `json:"info"`
 }
 
+// userRecord is a checked user, as a record of a report.
+type userRecord struct {
+	GhUserInfo
+}
+
 // Run the login test based on the parameters of the LoginCmd.
 func (l *LoginCmd) Run() error {
 	if err := setProxy(l.Proxy); err != nil {
 		return err
 	}
 
+	if err := loadSchemaFile(l.SchemaFile); err != nil {
+		return err
+	}
+
 	if l.BatchSize < 1 {
 		return fmt.Errorf("must specify a batch size of 1 or greater")
 	}
 
+	w, err := newReportWriter(l.Format, []string{"token", "schema", "user", "id", "name", "email"}, loginUserRule, loginFailedRule)
+	if err != nil {
+		return err
+	}
+
+	var source tokenSource
 	switch {
 	case l.NoAuth:
-		return testLoginWithTokens(context.Background(), l.Host, nilTokenSource(l.NumTokens), l.BatchSize, l.ForceCheck, l.Debug)
+		source = nilTokenSource(l.NumTokens, 1)
 	case l.Generated:
 		if len(l.Prefix) > 0 && !ghtoken.IsValidPrefix(l.Prefix) {
 			return fmt.Errorf("prefix '%s' is not a valid token prefix", l.Prefix)
 		}
 
-		return testLoginWithTokens(context.Background(), l.Host, generatedTokenSource(l.Prefix, l.NumTokens), l.BatchSize, l.ForceCheck, l.Debug)
+		var newGen func(batch uint64) *ghtoken.Generator
+		newGen, err = l.batchGenerators()
+		if err != nil {
+			return err
+		}
+		source = generatedTokenSource(newGen, l.Prefix, l.NumTokens, 1)
 	case len(l.File) > 0:
-		source, err := fileTokenSource(l.File, l.NumTokens)
+		source, err = fileTokenSource(l.File, l.NumTokens, 1)
 		if err != nil {
 			return err
 		}
-
-		return testLoginWithTokens(context.Background(), l.Host, source, l.BatchSize, l.ForceCheck, l.Debug)
 	default:
 		token := ghtoken.ParseGhToken(l.Token)
 		if len(token.FullToken) < 1 {
 			return fmt.Errorf("error: token '%s' is malformed", l.Token)
 		}
-		//nolint:exhaustruct
-		source := &sTokenSource{
-			tokens: []*ghtoken.GhToken{token},
-		}
-
-		return testLoginWithTokens(context.Background(), l.Host, source, l.BatchSize, l.ForceCheck, l.Debug)
+		source = staticTokenSource([]*ghtoken.GhToken{token}, 1)
 	}
+
+	testLoginWithTokens(context.Background(), l.Host, source, w, l.BatchSize, l.ForceCheck, l.Debug)
+
+	return w.Flush() //nolint:wrapcheck
 }
 
 type testResult struct {
@@ -101,35 +136,32 @@ type testBundle struct {
 // valid, the information for the current user is queried.  In the future,
 // different api endpoints should be queried based on the type of token being
 // tested.
-func testLoginWithTokens(ctx context.Context, host string, source tokenSource, batchSize int, forceCheck, debug bool) error {
+func testLoginWithTokens(ctx context.Context, host string, source tokenSource, w *report.Writer, batchSize int, forceCheck, debug bool) {
 	log.Printf("testing w/ %d tokens", source.remaining())
-	tokensLeft := source.remaining()
 	progress := bar.NewBar(source.remaining())
-	wg := sync.WaitGroup{}
 	bundles := make(chan *testBundle, batchSize)
-	// kick off the initial batch of workers
-	for !source.done() && batchSize > 0 {
+	// a fixed pool of workers pulls tokens from the source until it's drained,
+	// so concurrent requests are bounded by the batch size.
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < batchSize; worker++ {
 		wg.Add(1)
-		token, err := source.pop()
-		if err != nil {
-			return fmt.Errorf("error popping token: %w", err)
-		}
-		go asyncTestTokenViaRateLimit(ctx, &wg, bundles, host, token)
-		batchSize--
+		go func() {
+			defer wg.Done()
+			buf := make([]*ghtoken.GhToken, 0, 1)
+			for buf, _ = source.next(buf[:0]); len(buf) > 0; buf, _ = source.next(buf[:0]) {
+				for _, token := range buf {
+					bundles <- testTokenViaRateLimit(ctx, host, token)
+				}
+			}
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(bundles)
+	}()
+
 	gotem := make([]*testBundle, 0)
 	for b := range bundles {
-		// as we're gathering results and the source hasn't been drained, kick off
-		// new workers; this makes sure that concurrent workers aren't entirely
-		// unbounded
-		if !source.done() {
-			wg.Add(1)
-			token, err := source.pop()
-			if err != nil {
-				return fmt.Errorf("error popping token: %w", err)
-			}
-			go asyncTestTokenViaRateLimit(ctx, &wg, bundles, host, token)
-		}
 		if debug {
 			log.Printf("result for token '%+v' --- ", b.tok)
 			log.Printf("--- msg: %s", b.result.msg)
@@ -142,18 +174,12 @@ func testLoginWithTokens(ctx context.Context, host string, source tokenSource, b
 		}
 		// TODO: figure out a better place to do this
 		if forceCheck {
-			checkCurrentUser(ctx, b.client, b.tok)
+			checkCurrentUser(ctx, w, b.client, b.tok)
 		}
 		if err := progress.Inc(); err != nil {
 			log.Printf("error adding to the progressbar? %v", err)
 		}
-		tokensLeft--
-		if tokensLeft < 1 {
-			break
-		}
 	}
-	close(bundles)
-	wg.Wait()
 	if err := progress.Finish(); err != nil {
 		log.Printf("error finishing the progressbar? %v", err)
 	}
@@ -166,23 +192,15 @@ func testLoginWithTokens(ctx context.Context, host string, source tokenSource, b
 	}
 	for _, b := range gotem {
 		observeRateLimit(b.result.rate)
-		checkCurrentUser(ctx, b.client, b.tok)
+		checkCurrentUser(ctx, w, b.client, b.tok)
 	}
-
-	return nil
 }
 
-func asyncTestTokenViaRateLimit(ctx context.Context, wg *sync.WaitGroup, bundles chan *testBundle, host string, token *ghtoken.GhToken) {
+// Test a token via the rate limit api.
+func testTokenViaRateLimit(ctx context.Context, host string, token *ghtoken.GhToken) *testBundle {
 	client, err := newGithubClient(ctx, host, token)
-	if err == nil {
-		result := queryRateLimit(ctx, client, token)
-		bundles <- &testBundle{
-			client: client,
-			tok:    token,
-			result: result,
-		}
-	} else {
-		bundles <- &testBundle{
+	if err != nil {
+		return &testBundle{
 			client: nil,
 			tok:    token,
 			result: &testResult{
@@ -193,7 +211,12 @@ func asyncTestTokenViaRateLimit(ctx context.Context, wg *sync.WaitGroup, bundles
 			},
 		}
 	}
-	wg.Done()
+
+	return &testBundle{
+		client: client,
+		tok:    token,
+		result: queryRateLimit(ctx, client, token),
+	}
 }
 
 // Test credentials populated in the github client for validity via the rate limit api.
@@ -244,7 +267,8 @@ func queryRateLimit(ctx context.Context, client *github.Client, token *ghtoken.G
 	}
 }
 
-func checkCurrentUser(ctx context.Context, client *github.Client, token *ghtoken.GhToken) {
+// Check the user logged in as w/ the given client, and report it.
+func checkCurrentUser(ctx context.Context, w *report.Writer, client *github.Client, token *ghtoken.GhToken) {
 	usr, _, err := client.Users.Get(ctx, "")
 	if err != nil {
 		log.Printf("got an error from the client: %v", err)
@@ -255,8 +279,49 @@ func checkCurrentUser(ctx context.Context, client *github.Client, token *ghtoken
 		Info:  usr,
 	}
 
-	if err := fileutil.WriteJSON(os.Stdout, info); err != nil {
-		log.Printf("error parsing user info: %v", err)
+	if err := w.Write(userRecord{info}); err != nil {
+		log.Printf("error reporting user info: %v", err)
+	}
+}
+
+// Row returns the columns of the checked user; the user's columns are empty
+// if the check failed.
+func (u userRecord) Row() []string {
+	row := make([]string, 0, 6) //nolint:gomnd
+	if u.Token != nil {
+		row = append(row, u.Token.FullToken, u.Token.Schema)
+	} else {
+		row = append(row, "", "")
+	}
+	if u.Info != nil {
+		row = append(row, u.Info.GetLogin(), strconv.FormatInt(u.Info.GetID(), 10), u.Info.GetName(), u.Info.GetEmail())
+	} else {
+		row = append(row, "", "", "", "")
+	}
+
+	return row
+}
+
+// Result returns the checked user as a SARIF result.
+func (u userRecord) Result() report.Result {
+	token, props := "", map[string]any{}
+	if u.Token != nil {
+		token, props["schema"] = u.Token.FullToken, u.Token.Schema
+	}
+
+	rule, msg := loginFailedRule, fmt.Sprintf("token '%s' failed to log in as a user", token)
+	if u.Info != nil {
+		rule, msg = loginUserRule, fmt.Sprintf("token '%s' logged in as user '%s'", token, u.Info.GetLogin())
+		props["user"], props["id"] = u.Info.GetLogin(), u.Info.GetID()
+	}
+
+	return report.Result{
+		RuleID:              rule.ID,
+		Level:               "",
+		Message:             report.Message{Text: msg},
+		Locations:           nil,
+		PartialFingerprints: nil,
+		Properties:          props,
 	}
 }
 
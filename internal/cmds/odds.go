@@ -0,0 +1,85 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the odds
+// command.
+package cmds
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pyqlsa/token-forge/internal/odds"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+// oddsDigits is the number of significant digits probabilities are printed
+// w/.
+const oddsDigits = 6
+
+// OddsCmd represents the collision odds cli command.
+type OddsCmd struct {
+	Globals
+	SchemaArgs
+	Prefix string  `default:"ghp" help:"Token prefix whose schema determines the keyspace."                                                                     short:"p"`
+	Issued string  `default:"1e9" help:"Number of distinct live tokens (N); accepts scientific notation."                                                           short:"i"`
+	Draws  string  `default:"1e9" help:"Number of tokens drawn at random in an attempt to hit a live token (M); accepts scientific notation."                      short:"d"`
+	Target float64 `default:"0.5" help:"Target probability of at least one collision, for which to calculate the draws needed; must be greater than 0 and less than 1."`
+}
+
+// Run the odds command to calculate the odds of token collisions.
+func (o *OddsCmd) Run() error {
+	if err := loadSchemaFile(o.SchemaFile); err != nil {
+		return err
+	}
+
+	s, ok := ghtoken.GetSchema(o.Prefix)
+	if !ok {
+		return fmt.Errorf("prefix '%s' is not a valid token prefix", o.Prefix)
+	}
+
+	issued, err := odds.ParseCount(o.Issued)
+	if err != nil {
+		return fmt.Errorf("invalid number of issued tokens: %w", err)
+	}
+
+	draws, err := odds.ParseCount(o.Draws)
+	if err != nil {
+		return fmt.Errorf("invalid number of draws: %w", err)
+	}
+
+	keyspace := odds.Keyspace(s)
+	calc := odds.New(keyspace, issued, draws)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintf(w, "schema:\t%s (%s)\n", s.Name, s.Prefix)
+	fmt.Fprintf(w, "random symbols:\t%d of %d payload symbols; the last %d are the checksum of the rest\n",
+		odds.RandomSymbols(s), s.PayloadLength(), s.ChecksumLength)
+	fmt.Fprintf(w, "keyspace (K):\t%d^%d = %s\n", len(s.Alphabet), odds.RandomSymbols(s), formatInt(keyspace))
+	fmt.Fprintf(w, "issued tokens (N):\t%s\n", formatInt(issued))
+	fmt.Fprintf(w, "draws (M):\t%s\n", formatInt(draws))
+	fmt.Fprintf(w, "P(at least one collision), exact:\t%s\n", calc.Exact().Text('g', oddsDigits))
+	fmt.Fprintf(w, "P(at least one collision), approximate:\t%s\n", calc.Approx().Text('g', oddsDigits))
+	fmt.Fprintf(w, "expected collisions:\t%s\n", calc.Expected().Text('g', oddsDigits))
+	if needed := calc.DrawsFor(o.Target); needed != nil {
+		fmt.Fprintf(w, "draws for %g probability:\t%s\n", o.Target, formatInt(needed))
+	} else {
+		fmt.Fprintf(w, "draws for %g probability:\tunreachable\n", o.Target)
+	}
+	fmt.Fprintf(w, "P(any two issued tokens collide), approximate:\t%s\n", calc.Birthday().Text('g', oddsDigits))
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed printing odds: %w", err)
+	}
+
+	return nil
+}
+
+// Format an integer in full if it's short, or in scientific notation if not.
+func formatInt(n *big.Int) string {
+	if len(n.String()) <= 2*oddsDigits {
+		return n.String()
+	}
+
+	return new(big.Float).SetInt(n).Text('g', oddsDigits)
+}
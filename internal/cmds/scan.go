@@ -0,0 +1,210 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the implementation for the scan
+// command.
+package cmds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/report"
+	"github.com/pyqlsa/token-forge/internal/scan"
+)
+
+// Rules that scan findings are reported under, in SARIF reports.
+var (
+	validTokenRule = report.Rule{
+		ID:                   "valid-token",
+		ShortDescription:     report.Message{Text: "Token w/ a valid checksum"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelError},
+	}
+	invalidTokenRule = report.Rule{
+		ID:                   "invalid-checksum",
+		ShortDescription:     report.Message{Text: "Token candidate w/ an invalid checksum"},
+		DefaultConfiguration: report.Configuration{Level: report.LevelNote},
+	}
+)
+
+// ScanCmd represents the scan for tokens cli command.
+type ScanCmd struct {
+	Globals
+	SchemaArgs
+	Paths       []string `arg:""                                                                                                                                                                                            help:"Files and directories to scan, or git repositories w/ --git or --staged; defaults to the current directory." optional:""`
+	All         bool     `help:"Report every token candidate, not only those w/ a valid checksum."                                                                                                                          short:"a"`
+	Exclude     []string `default:".git"                                                                                                                                                                                    help:"Glob patterns of the names of files and directories to skip while walking; given paths are never skipped." short:"e"`
+	MaxFileSize int64    `default:"10485760"                                                                                                                                                                                help:"Size in bytes of the largest file to scan; larger files are skipped."`
+	Git         bool     `help:"Scan the history of the given git repositories rather than files: every blob of every commit, branch, and tag is scanned once, and tokens are reported w/ the commit that introduced them." xor:"mode"`
+	Staged      bool     `help:"Scan the changes staged in the index of the given git repositories rather than files, as a pre-commit hook does; only tokens on added lines are reported."                                  xor:"mode"`
+	Stdin       bool     `help:"Scan text piped to stdin rather than files."                                                                                                                                                xor:"mode"`
+	Format      string   `default:"table"                                                                                                                                                                                   enum:"table,json,jsonl,csv,sarif"                                                                                help:"Format of the findings: table, json, jsonl, csv, or sarif."               short:"o"`
+}
+
+// findingRecord is a scan finding, as a record of a report.
+type findingRecord struct {
+	scan.Finding
+}
+
+// Exit codes of the scan command, so scripts and hooks can tell finding a
+// token from failing to scan; kong already exits w/ 1 on usage errors (e.g.
+// unknown flags), so neither uses it.
+const (
+	scanExitFailed = 2
+	scanExitFound  = 3
+)
+
+// Help returns the detailed help of the scan command, documenting it's exit
+// codes.
+func (s *ScanCmd) Help() string {
+	return fmt.Sprintf("Exits w/ 0 if no tokens w/ a valid checksum were found, %d if any were, %d if the scan failed, "+
+		"and 1 on usage errors.", scanExitFound, scanExitFailed)
+}
+
+// Run the scan command to find tokens in files and directories; it exits w/
+// scanExitFound if it found tokens w/ a valid checksum, and w/ scanExitFailed
+// if it failed.
+func (s *ScanCmd) Run() error {
+	// paths are only defaulted here, so paths given along w/ --stdin, even
+	// the current directory, are told apart from none.
+	if s.Stdin && len(s.Paths) > 0 {
+		return fmt.Errorf("paths can't be scanned along w/ stdin")
+	}
+	if len(s.Paths) == 0 {
+		s.Paths = []string{"."}
+	}
+
+	err := s.run()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, scan.ErrFound):
+		return &ExitError{Code: scanExitFound, Err: err}
+	default:
+		return &ExitError{Code: scanExitFailed, Err: err}
+	}
+}
+
+// Run the scan.
+func (s *ScanCmd) run() error {
+	if err := loadSchemaFile(s.SchemaFile); err != nil {
+		return err
+	}
+
+	header := []string{"path", "line", "column", "schema", "token", "valid"}
+	if s.Git {
+		header = append(header, "commit", "author", "date")
+	}
+	w, err := newReportWriter(s.Format, header, validTokenRule, invalidTokenRule)
+	if err != nil {
+		return err
+	}
+
+	var werr error
+	found := func(f scan.Finding) {
+		if err := w.Write(findingRecord{f}); err != nil && werr == nil {
+			werr = err
+		}
+	}
+
+	opts := scan.Options{All: s.All, Exclude: s.Exclude, MaxFileSize: s.MaxFileSize}
+	stats, err := s.scan(opts, found)
+	if err != nil {
+		return fmt.Errorf("failed scanning: %w", err)
+	}
+	if werr == nil {
+		werr = w.Flush()
+	}
+	if werr != nil {
+		return werr
+	}
+
+	log.Printf("scanned %d %s, skipped %d; found %d tokens w/ a valid checksum, %d w/o", stats.Files, s.scanned(), stats.Skipped, stats.Valid, stats.Invalid)
+	if stats.Valid > 0 {
+		return fmt.Errorf("%w: %d", scan.ErrFound, stats.Valid)
+	}
+
+	return nil
+}
+
+// Scan either stdin, or the paths, as files and directories, or as git
+// repositories.
+func (s *ScanCmd) scan(opts scan.Options, found func(scan.Finding)) (scan.Stats, error) {
+	switch {
+	case s.Stdin:
+		findings, stats, err := scan.ScanReader("stdin", os.Stdin, opts)
+		for _, f := range findings {
+			found(f)
+		}
+
+		return stats, err //nolint:wrapcheck
+	case !s.Git && !s.Staged:
+		//nolint:wrapcheck
+		return scan.Walk(s.Paths, opts, found, func(path string, err error) {
+			log.Printf("skipping '%s': %v", path, err)
+		})
+	}
+
+	walk := scan.WalkGit
+	if s.Staged {
+		walk = scan.WalkStaged
+	}
+
+	var stats scan.Stats
+	for _, repo := range s.Paths {
+		repoStats, err := walk(context.Background(), repo, opts, found)
+		stats = stats.Add(repoStats)
+		if err != nil {
+			return stats, err //nolint:wrapcheck
+		}
+	}
+
+	return stats, nil
+}
+
+// Return what is counted as scanned.
+func (s *ScanCmd) scanned() string {
+	if s.Git {
+		return "blobs"
+	}
+
+	return "files"
+}
+
+// Row returns the columns of the finding; the commit columns are only
+// included for findings from a commit.
+func (f findingRecord) Row() []string {
+	row := []string{f.Path, strconv.Itoa(f.Line), strconv.Itoa(f.Column), f.Schema, f.Masked, strconv.FormatBool(f.Valid)}
+	if f.Commit != nil {
+		row = append(row, f.Commit.SHA, f.Commit.Author, f.Commit.Date.Format(time.RFC3339))
+	}
+
+	return row
+}
+
+// Result returns the finding as a SARIF result; findings are fingerprinted by
+// a hash of their full token and location (see scan.Finding.Fingerprint), so
+// the same finding is recognized across runs, even if it's line changes.
+func (f findingRecord) Result() report.Result {
+	rule, msg := validTokenRule, "%s token w/ a valid checksum: %s"
+	if !f.Valid {
+		rule, msg = invalidTokenRule, "%s token candidate w/ an invalid checksum: %s"
+	}
+
+	props := map[string]any{"schema": f.Schema, "prefix": f.Prefix}
+	if f.Commit != nil {
+		props["commit"], props["author"], props["date"] = f.Commit.SHA, f.Commit.Author, f.Commit.Date.Format(time.RFC3339)
+	}
+
+	return report.Result{
+		RuleID:              rule.ID,
+		Level:               "",
+		Message:             report.Message{Text: fmt.Sprintf(msg, f.Schema, f.Masked)},
+		Locations:           []report.Location{report.NewLocation(f.Path, f.Line, f.Column, len(f.Masked))},
+		PartialFingerprints: map[string]string{"tokenLocation/sha256/v1": f.Fingerprint()},
+		Properties:          props,
+	}
+}
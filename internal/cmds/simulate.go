@@ -0,0 +1,296 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the time-aware simulation of the
+// local command.
+package cmds
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/bar"
+	"github.com/pyqlsa/token-forge/internal/odds"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/issuer"
+)
+
+// never is the expiry of tokens that never expire.
+const never = time.Duration(math.MaxInt64)
+
+// SimulationArgs represents parameters for simulating token issuance over
+// time.
+type SimulationArgs struct {
+	Duration  time.Duration            `group:"Simulation" help:"Simulate issuance and testing over the given span of time (e.g. 24h), rather than testing against a static database (so --load, --save, --num-tests, --workers, and the bloom filter flags can't be used); --num-tokens are tested evenly over the span."`
+	Rates     map[string]float64       `default:"ghp=100;gho=100;ghu=100;ghs=100" group:"Simulation" help:"Issuance rate of each simulated prefix, in tokens per hour; tokens are issued evenly over the span."`
+	Lifetimes map[string]time.Duration `group:"Simulation" help:"Lifetime of tokens of each prefix, overriding the defaults (ghs=1h;ghu=8h); a lifetime of 0 never expires, as do prefixes w/o a lifetime."`
+}
+
+// timedTokenDB is a database of issued tokens, holding the simulated time
+// each token expires at; expired tokens are kept for a lifetime after they
+// expire, to tell hits against them apart from misses, and then dropped, so
+// the database stays bounded over long spans.
+type timedTokenDB map[string]time.Duration
+
+// expiry is the expiry of an issued token.
+type expiry struct {
+	token string
+	at    time.Duration
+}
+
+// simPrefix holds the state and results of a simulated prefix.
+type simPrefix struct {
+	prefix   string
+	lifetime time.Duration
+	rate     float64
+	keyspace float64
+	// next is the simulated time of the next issuance.
+	next   time.Duration
+	issued uint64
+	// expiries holds the expiry of every token still in the database that
+	// expires, oldest first, from head on; tokens of a prefix share a
+	// lifetime, so they expire in the order they're issued. Those before
+	// firstLive have expired; they're dropped once they've been expired for a
+	// lifetime, and the slice is compacted once dropped tokens make up most
+	// of it.
+	expiries  []expiry
+	head      int
+	firstLive int
+	tested    uint64
+	hits      uint64
+	// expiredHits is the number of tested tokens that matched an expired
+	// token, i.e. hits of a static database that aren't hits in time.
+	expiredHits uint64
+	// liveSum and expected hold the sums, over every tested token, of the
+	// number of live tokens and the probability of hitting one.
+	liveSum  float64
+	expected float64
+}
+
+// simulation is a time-aware local collision test.
+type simulation struct {
+	gen      *ghtoken.Generator
+	db       timedTokenDB
+	prefixes []*simPrefix
+}
+
+// newSimulation returns a simulation of the given prefixes, issued at the
+// given rates w/ the given lifetimes.
+func (a SimulationArgs) newSimulation(gen *ghtoken.Generator) (*simulation, error) {
+	lifetimes := issuer.DefaultLifetimes()
+	for prefix, lifetime := range a.Lifetimes {
+		lifetimes[prefix] = lifetime
+	}
+
+	sim := &simulation{
+		gen:      gen,
+		db:       make(timedTokenDB),
+		prefixes: make([]*simPrefix, 0, len(a.Rates)),
+	}
+
+	for prefix, rate := range a.Rates {
+		s, ok := ghtoken.GetSchema(prefix)
+		if !ok {
+			return nil, fmt.Errorf("prefix '%s' is not a valid token prefix", prefix)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("issuance rate of prefix '%s' must be positive", prefix)
+		}
+
+		lifetime := lifetimes[prefix]
+		if lifetime <= 0 {
+			lifetime = never
+		}
+		keyspace, _ := new(big.Float).SetInt(odds.Keyspace(s)).Float64()
+
+		//nolint:exhaustruct
+		sim.prefixes = append(sim.prefixes, &simPrefix{
+			prefix:   prefix,
+			lifetime: lifetime,
+			rate:     rate,
+			keyspace: keyspace,
+			next:     issuedAt(1, rate),
+			expiries: make([]expiry, 0),
+		})
+	}
+	sort.Slice(sim.prefixes, func(i, j int) bool { return sim.prefixes[i].prefix < sim.prefixes[j].prefix })
+
+	if len(sim.prefixes) < 1 {
+		return nil, fmt.Errorf("at least one prefix must have an issuance rate")
+	}
+
+	return sim, nil
+}
+
+// run tests the given number of tokens evenly over the given span of
+// simulated time, each w/ the given prefix, or w/ each simulated prefix in
+// turn if the prefix is empty; tokens are issued up to the instant each
+// token is tested.
+func (sim *simulation) run(span time.Duration, num uint64, prefix string) error {
+	targets := sim.prefixes
+	if len(prefix) > 0 {
+		targets = nil
+		for _, p := range sim.prefixes {
+			if p.prefix == prefix {
+				targets = []*simPrefix{p}
+			}
+		}
+		if targets == nil {
+			return fmt.Errorf("prefix '%s' has no issuance rate", prefix)
+		}
+	}
+
+	log.Printf("simulating %s, testing w/ %d tokens", span, num)
+	progress := bar.NewBar(num)
+	for i := uint64(0); i < num; i++ {
+		at := time.Duration(float64(span) * float64(i) / float64(num))
+		sim.issueUntil(at)
+		sim.test(at, targets[i%uint64(len(targets))])
+		sim.forget(at)
+		if err := progress.Inc(); err != nil {
+			log.Printf("error adding to the progressbar? %v", err)
+		}
+	}
+	if err := progress.Finish(); err != nil {
+		log.Printf("error finishing the progressbar? %v", err)
+	}
+
+	// issue the rest of the span, so issuance is reported in full.
+	sim.issueUntil(span)
+
+	return nil
+}
+
+// issueUntil issues every token due by the given instant.
+func (sim *simulation) issueUntil(at time.Duration) {
+	for _, p := range sim.prefixes {
+		for p.next <= at {
+			fake := sim.gen.Generate(p.prefix)
+			expires := p.next + p.lifetime
+			if p.lifetime == never {
+				expires = never
+			}
+
+			if existing, found := sim.db[fake.FullToken]; found && existing > p.next {
+				log.Printf("observed token collision while issuing token: %s", fake.FullToken)
+			} else {
+				sim.db[fake.FullToken] = expires
+				p.issued++
+				if expires != never {
+					p.expiries = append(p.expiries, expiry{token: fake.FullToken, at: expires})
+				}
+			}
+
+			p.next = issuedAt(p.issued+1, p.rate)
+		}
+	}
+}
+
+// issuedAt returns the instant the nth token of a prefix issued at the given
+// rate is issued; the first is issued after one interval, so a span issues
+// exactly it's length times the rate.
+func issuedAt(n uint64, rate float64) time.Duration {
+	return time.Duration(float64(time.Hour) * float64(n) / rate)
+}
+
+// test tests a token of the given prefix at the given instant.
+func (sim *simulation) test(at time.Duration, p *simPrefix) {
+	live := p.live(at)
+	p.tested++
+	p.liveSum += float64(live)
+	p.expected += float64(live) / p.keyspace
+
+	token := sim.gen.Generate(p.prefix)
+	expires, found := sim.db[token.FullToken]
+	switch {
+	case !found:
+	case at < expires:
+		p.hits++
+		log.Printf("!!! collision: %s", token.FullToken)
+	default:
+		p.expiredHits++
+	}
+}
+
+// live returns the number of tokens of the prefix that are live at the given
+// instant.
+func (p *simPrefix) live(at time.Duration) uint64 {
+	for p.firstLive < len(p.expiries) && p.expiries[p.firstLive].at <= at {
+		p.firstLive++
+	}
+
+	if p.lifetime == never {
+		return p.issued
+	}
+
+	return uint64(len(p.expiries) - p.firstLive)
+}
+
+// forget drops the tokens that have been expired for at least a lifetime at
+// the given instant from the database; hits against them are tallied as
+// misses from then on.
+func (sim *simulation) forget(at time.Duration) {
+	for _, p := range sim.prefixes {
+		p.live(at)
+
+		for p.head < p.firstLive && p.expiries[p.head].at <= at-p.lifetime {
+			// the token may have been issued again since it expired.
+			if e := p.expiries[p.head]; sim.db[e.token] == e.at {
+				delete(sim.db, e.token)
+			}
+			// clear the dropped token, so it's string can be collected.
+			p.expiries[p.head] = expiry{} //nolint:exhaustruct
+			p.head++
+		}
+
+		if p.head > len(p.expiries)/2 { //nolint:gomnd
+			n := copy(p.expiries, p.expiries[p.head:])
+			clear(p.expiries[n:])
+			p.expiries = p.expiries[:n]
+			p.firstLive -= p.head
+			p.head = 0
+		}
+	}
+}
+
+// print prints the results of the simulation at the end of the given span.
+func (sim *simulation) print(span time.Duration) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(w, "prefix\tlifetime\trate/h\tissued\tlive at end\tmean live when tested\ttested\thits\thits on expired tokens\texpected hits")
+	for _, p := range sim.prefixes {
+		lifetime := p.lifetime.String()
+		if p.lifetime == never {
+			lifetime = "never expires"
+		}
+
+		meanLive := 0.0
+		if p.tested > 0 {
+			meanLive = p.liveSum / float64(p.tested)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%g\t%d\t%d\t%.1f\t%d\t%d\t%d\t%.4g\n",
+			p.prefix, lifetime, p.rate, p.issued, p.live(span), meanLive, p.tested, p.hits, p.expiredHits, p.expected)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed printing simulation results: %w", err)
+	}
+
+	return nil
+}
+
+// collisions returns the number of hits against live tokens, and against
+// expired tokens, over every prefix.
+func (sim *simulation) collisions() (uint64, uint64) {
+	hits, expired := uint64(0), uint64(0)
+	for _, p := range sim.prefixes {
+		hits += p.hits
+		expired += p.expiredHits
+	}
+
+	return hits, expired
+}
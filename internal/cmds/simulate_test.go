@@ -0,0 +1,112 @@
+// Package cmds provides the implementation backing token-forge's cli.
+// This section of the cmds package holds the tests of the simulation, which
+// check it's bookkeeping directly, so they can't live in cmds_test.
+package cmds
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/bar"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTinySimulation returns a simulation of the given prefix, whose schema
+// has a keyspace of only the given number of random symbols, so that the
+// simulation actually collides; the prefix is issued at the given rate w/ the
+// given lifetime.
+func newTinySimulation(t *testing.T, prefix string, symbols int, rate float64, lifetime time.Duration) (*simulation, *simPrefix) {
+	t.Helper()
+	if _, found := schema.Lookup(prefix); !found {
+		//nolint:exhaustruct
+		s, err := schema.SchemaConfig{Name: "simulation-" + prefix, Prefix: prefix, BodyLength: symbols}.Schema()
+		if !assert.NoError(t, err) || !assert.NoError(t, schema.Register(s)) {
+			t.FailNow()
+		}
+	}
+
+	//nolint:exhaustruct
+	args := SimulationArgs{
+		Rates:     map[string]float64{prefix: rate},
+		Lifetimes: map[string]time.Duration{prefix: lifetime},
+	}
+	sim, err := args.newSimulation(ghtoken.NewSeededGenerator(1))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return sim, sim.prefixes[0]
+}
+
+func TestSimulationBookkeeping(t *testing.T) {
+	t.Parallel()
+	sim, p := newTinySimulation(t, "tnb", 2, 1, 2*time.Hour)
+
+	// one token an hour, from 1h on, each live for 2 hours.
+	sim.issueUntil(5 * time.Hour)
+	assert.Equal(t, uint64(5), p.issued, "unexpected tokens issued by 5h")
+	assert.Equal(t, uint64(2), p.live(5*time.Hour), "only the tokens issued at 4h and 5h should be live")
+	assert.Equal(t, 3, p.firstLive)
+
+	// the token issued at 1h expired at 3h, a lifetime ago, so it's dropped.
+	sim.forget(5 * time.Hour)
+	assert.Equal(t, 1, p.head)
+	assert.Len(t, sim.db, 4, "only tokens expired for less than a lifetime should be kept")
+
+	// replay the issued tokens as tested tokens: the first was dropped, the
+	// next two have expired, and the last two are live.
+	sim.gen = ghtoken.NewSeededGenerator(1)
+	for i := 0; i < 5; i++ {
+		sim.test(5*time.Hour, p)
+	}
+	assert.Equal(t, uint64(5), p.tested)
+	assert.Equal(t, uint64(2), p.hits, "only hits against live tokens should be hits")
+	assert.Equal(t, uint64(2), p.expiredHits, "hits against expired tokens should be tallied apart")
+
+	// by 9h, the tokens issued up to 5h have been dropped, which is most of
+	// them, so the expiries are compacted.
+	sim.issueUntil(9 * time.Hour)
+	sim.forget(9 * time.Hour)
+	assert.Equal(t, uint64(9), p.issued)
+	assert.Equal(t, 0, p.head, "expiries should be compacted")
+	assert.Len(t, p.expiries, 4, "only the tokens issued from 6h on should be left")
+	assert.Equal(t, 2, p.firstLive, "the first live token should be kept through compaction")
+	assert.Equal(t, 10*time.Hour, p.expiries[p.firstLive].at)
+	assert.Equal(t, uint64(2), p.live(9*time.Hour))
+	assert.Len(t, sim.db, 4)
+}
+
+//nolint:paralleltest // silences the log and progress bars, which other parallel tests write to
+func TestSimulationRun(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	bar.SetOutput(io.Discard)
+	defer func() {
+		log.SetOutput(out)
+		bar.SetOutput(os.Stderr)
+	}()
+
+	// 62 tokens, 10 of them live at any instant, tested 1000 times over a
+	// day; hits against both live and expired tokens are all but certain.
+	sim, p := newTinySimulation(t, "tnr", 1, 5, 2*time.Hour)
+	if !assert.NoError(t, sim.run(24*time.Hour, 1000, "")) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, uint64(120), p.issued, "a day should issue the rate times 24 tokens")
+	assert.Equal(t, uint64(1000), p.tested)
+	assert.Equal(t, uint64(10), p.live(24*time.Hour))
+	assert.Positive(t, p.hits, "expected hits against live tokens")
+	assert.Positive(t, p.expiredHits, "expected hits against expired tokens")
+	assert.LessOrEqual(t, p.hits+p.expiredHits, p.tested)
+	assert.LessOrEqual(t, len(sim.db), 20, "tokens expired for over a lifetime should be dropped")
+
+	hits, expired := sim.collisions()
+	assert.Equal(t, p.hits, hits)
+	assert.Equal(t, p.expiredHits, expired)
+}
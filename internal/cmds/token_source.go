@@ -1,160 +1,175 @@
 // Package cmds provides the implementation backing token-forge's cli.
-// This section of the cmds package holds the implementation for the login
-// command.
+// This section of the cmds package holds the sources of tokens that the
+// concurrent pipelines pull from.
 package cmds
 
 import (
 	"fmt"
-	"sync"
+	"sync/atomic"
 
-	"github.com/pyqlsa/token-forge/internal/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
 )
 
-// tokenSource is an interface to a source of tokens.
+// tokenSource is an interface to a source of tokens, pulled in batches; it is
+// safe for concurrent use, w/o locking, so any number of workers can drain it
+// at once.
 type tokenSource interface {
-	pop() (*ghtoken.GhToken, error)
-	done() bool
+	// next appends the next batch of tokens to dst, returning it along w/ the
+	// batch's index, or returns dst unchanged once the source has been
+	// drained.
+	next(dst []*ghtoken.GhToken) ([]*ghtoken.GhToken, uint64)
+	// remaining returns the number of tokens that haven't been pulled.
 	remaining() uint64
 }
 
-// gTokenSource is a tokenSource that supplies randomly generated tokens.
-type gTokenSource struct {
-	mu        sync.Mutex
-	remain    uint64
-	tokenFunc func() *ghtoken.GhToken
+// claims hands out consecutive batches of indices, up to a limit, w/
+// compare-and-swap rather than a lock; every batch but the last is full, so
+// the index of a batch is it's start divided by the batch size.
+type claims struct {
+	pos   atomic.Uint64
+	limit uint64
+	batch uint64
 }
 
-// done signifies if the token source has been exhausted.
-func (g *gTokenSource) done() bool {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// newClaims returns claims up to the given limit, in batches of the given
+// size (at least 1).
+func newClaims(limit, batch uint64) claims {
+	if batch < 1 {
+		batch = 1
+	}
 
-	return g.remain < 1
+	//nolint:exhaustruct
+	return claims{limit: limit, batch: batch}
+}
+
+// claim claims the next batch, returning it's bounds; ok is false once every
+// index has been claimed.
+func (c *claims) claim() (uint64, uint64, bool) {
+	for {
+		start := c.pos.Load()
+		if start >= c.limit {
+			return 0, 0, false
+		}
+
+		end := start + min(c.batch, c.limit-start)
+		if c.pos.CompareAndSwap(start, end) {
+			return start, end, true
+		}
+	}
 }
 
-// remaining returns the number of tokens that remain in the source.
-func (g *gTokenSource) remaining() uint64 {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// skip skips the given number of batches, as if they had been claimed; it
+// must be called before anything is claimed.
+func (c *claims) skip(batches uint64) {
+	c.pos.Store(min(batches*c.batch, c.limit))
+}
+
+// remaining returns the number of indices that haven't been claimed.
+func (c *claims) remaining() uint64 {
+	return c.limit - min(c.pos.Load(), c.limit)
+}
 
-	return g.remain
+// gTokenSource is a tokenSource that supplies randomly generated tokens; each
+// batch is generated by the puller, outside of any lock, w/ a generator of
+// it's own.
+type gTokenSource struct {
+	claims
+	prefix string
+	newGen func(batch uint64) *ghtoken.Generator
 }
 
-// pop removes and returns a token from the source, or returns an error if the
-// source has been exhausted.
-func (g *gTokenSource) pop() (*ghtoken.GhToken, error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// next appends the next batch of tokens to dst, or returns dst unchanged once
+// the source has been drained.
+func (g *gTokenSource) next(dst []*ghtoken.GhToken) ([]*ghtoken.GhToken, uint64) {
+	start, end, ok := g.claim()
+	if !ok {
+		return dst, 0
+	}
 
-	if g.remain < 1 {
-		return nil, fmt.Errorf("token source has been drained")
+	genToken := GenGhTokenFunc(g.newGen(start/g.batch), g.prefix)
+	for i := start; i < end; i++ {
+		dst = append(dst, genToken())
 	}
-	g.remain--
 
-	return g.tokenFunc(), nil
+	return dst, start / g.batch
 }
 
 // generatedTokenSource returns a gTokenSource that supplies tokens with the
-// given prefix, up to the given limit.
-func generatedTokenSource(prefix string, limit uint64) *gTokenSource {
-	//nolint:exhaustruct
+// given prefix, up to the given limit, in batches of the given size; each
+// batch is generated w/ the generator returned for it's index, so if that
+// generator depends only on the index, the source supplies the same tokens
+// regardless of how many workers pull from it.
+func generatedTokenSource(newGen func(batch uint64) *ghtoken.Generator, prefix string, limit, batch uint64) *gTokenSource {
 	return &gTokenSource{
-		tokenFunc: GenGhTokenFunc(prefix),
-		remain:    limit,
+		claims: newClaims(limit, batch),
+		prefix: prefix,
+		newGen: newGen,
 	}
 }
 
+// nTokenSource is a tokenSource that supplies nil tokens, for unauthenticated
+// requests.
 type nTokenSource struct {
-	mu     sync.Mutex
-	remain uint64
+	claims
 }
 
-// done signifies if the token source has been exhausted.
-func (n *nTokenSource) done() bool {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-
-	return n.remain < 1
-}
-
-// remaining returns the number of tokens that remain in the source.
-func (n *nTokenSource) remaining() uint64 {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-
-	return n.remain
-}
-
-// pop removes and returns a token from the source, or returns an error if the
-// source has been exhausted.
-func (n *nTokenSource) pop() (*ghtoken.GhToken, error) {
-	n.mu.Lock()
-	defer n.mu.Unlock()
+// next appends the next batch of nil tokens to dst, or returns dst unchanged
+// once the source has been drained.
+func (n *nTokenSource) next(dst []*ghtoken.GhToken) ([]*ghtoken.GhToken, uint64) {
+	start, end, ok := n.claim()
+	if !ok {
+		return dst, 0
+	}
 
-	if n.remain < 1 {
-		return nil, fmt.Errorf("token source has been drained")
+	for i := start; i < end; i++ {
+		dst = append(dst, nil)
 	}
-	n.remain--
 
-	return nil, nil //nolint:nilnil
+	return dst, start / n.batch
 }
 
-func nilTokenSource(limit uint64) *nTokenSource {
-	//nolint:exhaustruct
+// nilTokenSource returns an nTokenSource that supplies up to the given limit
+// of nil tokens, in batches of the given size.
+func nilTokenSource(limit, batch uint64) *nTokenSource {
 	return &nTokenSource{
-		remain: limit,
+		claims: newClaims(limit, batch),
 	}
 }
 
 // sTokenSource is a tokenSource that supplies tokens that were acquired from
 // some other static source.
 type sTokenSource struct {
-	mu     sync.Mutex
+	claims
 	tokens []*ghtoken.GhToken
 }
 
-// done signifies if the token source has been exhausted.
-func (s *sTokenSource) done() bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	return len(s.tokens) < 1
-}
-
-// remaining returns the number of tokens that remain in the source.
-func (s *sTokenSource) remaining() uint64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// next appends the next batch of tokens to dst, or returns dst unchanged once
+// the source has been drained.
+func (s *sTokenSource) next(dst []*ghtoken.GhToken) ([]*ghtoken.GhToken, uint64) {
+	start, end, ok := s.claim()
+	if !ok {
+		return dst, 0
+	}
 
-	return uint64(len(s.tokens))
+	return append(dst, s.tokens[start:end]...), start / s.batch
 }
 
-// pop removes and returns a token from the source, or returns an error if the
-// source has been exhausted.
-func (s *sTokenSource) pop() (*ghtoken.GhToken, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if len(s.tokens) < 1 {
-		return nil, fmt.Errorf("token source has been drained")
+// staticTokenSource returns an sTokenSource that supplies the given tokens,
+// in batches of the given size.
+func staticTokenSource(tokens []*ghtoken.GhToken, batch uint64) *sTokenSource {
+	return &sTokenSource{
+		claims: newClaims(uint64(len(tokens)), batch),
+		tokens: tokens,
 	}
-	n := len(s.tokens) - 1
-	tok := s.tokens[n]
-	s.tokens = s.tokens[:n]
-
-	return tok, nil
 }
 
 // fileTokenSource returns an sTokenSource, saturated with tokens from the
-// given file, up to the given limit.
-func fileTokenSource(file string, limit uint64) (*sTokenSource, error) {
+// given file, up to the given limit, in batches of the given size.
+func fileTokenSource(file string, limit, batch uint64) (*sTokenSource, error) {
 	toks, err := getNumTokensFromFile(file, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed getting tokens from file '%s': %w", file, err)
 	}
 
-	//nolint:exhaustruct
-	return &sTokenSource{
-		tokens: toks,
-	}, nil
+	return staticTokenSource(toks, batch), nil
 }
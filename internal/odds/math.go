@@ -0,0 +1,106 @@
+// Package odds provides the probabilities of token collisions.
+// This section of the odds package holds natural logarithm and exponential
+// functions for big.Float, which the standard library doesn't provide.
+package odds
+
+import (
+	"math"
+	"math/big"
+)
+
+// minExpArg is the argument below which Exp returns 0; e^-1e9 is smaller than
+// any big.Float can represent.
+const minExpArg = -1e9
+
+// Log returns the natural logarithm of x, at the precision of x; x must be
+// positive. x is reduced to m * 2^e, w/ m in [0.5, 1), so that
+// ln(x) = ln(m) + e*ln(2), and ln(m) is evaluated by the series
+// ln(m) = 2*atanh((m-1)/(m+1)), which converges quickly since
+// |(m-1)/(m+1)| <= 1/3.
+func Log(x *big.Float) *big.Float {
+	prec := x.Prec()
+	m := new(big.Float).SetPrec(prec)
+	e := x.MantExp(m)
+
+	result := atanhLog(m, prec)
+	if e != 0 {
+		ln2 := ln2(prec)
+		result.Add(result, ln2.Mul(ln2, new(big.Float).SetPrec(prec).SetInt64(int64(e))))
+	}
+
+	return result
+}
+
+// Exp returns e^x, at the precision of x. x is reduced to k*ln(2) + r, w/
+// |r| <= ln(2)/2, so that e^x = e^r * 2^k, and e^r is evaluated by it's
+// Taylor series.
+func Exp(x *big.Float) *big.Float {
+	prec := x.Prec()
+	if f, _ := x.Float64(); f < minExpArg {
+		return new(big.Float).SetPrec(prec)
+	}
+
+	ln2 := ln2(prec)
+	kf := new(big.Float).SetPrec(prec).Quo(x, ln2)
+	k, _ := kf.Float64()
+	k = math.Round(k)
+
+	r := new(big.Float).SetPrec(prec).SetFloat64(k)
+	r.Mul(r, ln2)
+	r.Sub(x, r)
+
+	// e^r = sum r^n / n!
+	sum := new(big.Float).SetPrec(prec).SetInt64(1)
+	term := new(big.Float).SetPrec(prec).SetInt64(1)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetPrec(prec).SetInt64(n))
+		if negligible(term, sum) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+
+	return sum.SetMantExp(sum, int(k))
+}
+
+// Evaluate ln(m) = 2*atanh(z), w/ z = (m-1)/(m+1), as
+// 2*(z + z^3/3 + z^5/5 + ...).
+func atanhLog(m *big.Float, prec uint) *big.Float {
+	one := new(big.Float).SetPrec(prec).SetInt64(1)
+	z := new(big.Float).SetPrec(prec).Sub(m, one)
+	z.Quo(z, new(big.Float).SetPrec(prec).Add(m, one))
+
+	z2 := new(big.Float).SetPrec(prec).Mul(z, z)
+	power := new(big.Float).SetPrec(prec).Copy(z)
+	sum := new(big.Float).SetPrec(prec).Copy(z)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, z2)
+		term := new(big.Float).SetPrec(prec).Quo(power, new(big.Float).SetPrec(prec).SetInt64(n))
+		if negligible(term, sum) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+
+	return sum.Mul(sum, new(big.Float).SetPrec(prec).SetInt64(2)) //nolint:gomnd
+}
+
+// Return ln(2) at the given precision; ln(2) = 2*atanh(1/3).
+func ln2(prec uint) *big.Float {
+	return atanhLog(new(big.Float).SetPrec(prec).SetInt64(2), prec)
+}
+
+// Tests if adding the term to the sum would no longer change the sum at the
+// sum's precision.
+func negligible(term, sum *big.Float) bool {
+	if term.Sign() == 0 {
+		return true
+	}
+
+	if sum.Sign() == 0 {
+		return false
+	}
+
+	return term.MantExp(nil) < sum.MantExp(nil)-int(sum.Prec())-1
+}
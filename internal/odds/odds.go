@@ -0,0 +1,155 @@
+// Package odds provides the probabilities of token collisions, computed w/
+// arbitrary precision so that they stay accurate at the scale of a token
+// keyspace.
+package odds
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// guardBits is the precision kept beyond what is needed to represent 1 - 1/K
+// exactly, for a keyspace of size K.
+const guardBits = 128
+
+// RandomSymbols returns the number of random symbols in tokens of the given
+// schema, i.e. the payload w/o separators or the checksum; the checksum is a
+// function of the rest of the payload, so it adds nothing to the keyspace.
+func RandomSymbols(s schema.Schema) int {
+	return s.PayloadLength() - (len(s.Segments)-1)*len(schema.Sep) - s.ChecksumLength
+}
+
+// Keyspace returns the number of distinct tokens of the given schema, i.e.
+// 62^RandomSymbols.
+func Keyspace(s schema.Schema) *big.Int {
+	return new(big.Int).Exp(big.NewInt(schema.AlphabetSize), big.NewInt(int64(RandomSymbols(s))), nil)
+}
+
+// ParseCount parses a non-negative count, which may be in scientific notation
+// (e.g. '1e9'); counts are parsed exactly, however large they are, rather than
+// rounded to the precision of a float.
+func ParseCount(s string) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("failed parsing '%s'", s)
+	}
+
+	if r.Sign() < 0 || !r.IsInt() {
+		return nil, fmt.Errorf("'%s' is not a non-negative whole number", s)
+	}
+
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// Odds holds a scenario where Issued distinct tokens are live, out of a
+// keyspace of Keyspace tokens, and Draws tokens are drawn uniformly at
+// random (w/ replacement) in an attempt to hit any of them.
+type Odds struct {
+	Keyspace *big.Int
+	Issued   *big.Int
+	Draws    *big.Int
+	prec     uint
+}
+
+// New returns the odds of the given scenario.
+func New(keyspace, issued, draws *big.Int) *Odds {
+	return &Odds{
+		Keyspace: keyspace,
+		Issued:   issued,
+		Draws:    draws,
+		prec:     uint(2*keyspace.BitLen() + guardBits),
+	}
+}
+
+// float returns a new float of the scenario's precision.
+func (o *Odds) float() *big.Float {
+	return new(big.Float).SetPrec(o.prec)
+}
+
+// hitRate returns the probability that a single draw hits an issued token,
+// N/K, capped at 1.
+func (o *Odds) hitRate() *big.Float {
+	q := o.float().Quo(o.float().SetInt(o.Issued), o.float().SetInt(o.Keyspace))
+	if q.Cmp(big.NewFloat(1)) > 0 {
+		q.SetInt64(1)
+	}
+
+	return q
+}
+
+// Exact returns the probability that at least one draw hits an issued
+// token, 1 - (1 - N/K)^M.
+func (o *Odds) Exact() *big.Float {
+	miss := o.float().Sub(o.float().SetInt64(1), o.hitRate())
+
+	return o.float().Sub(o.float().SetInt64(1), pow(miss, o.Draws))
+}
+
+// Approx returns the commonly used approximation of Exact, 1 - e^(-NM/K);
+// it is accurate while N/K is small.
+func (o *Odds) Approx() *big.Float {
+	return o.float().Sub(o.float().SetInt64(1), Exp(o.float().Neg(o.Expected())))
+}
+
+// Expected returns the expected number of draws that hit an issued token,
+// NM/K.
+func (o *Odds) Expected() *big.Float {
+	nm := o.float().SetInt(new(big.Int).Mul(o.Issued, o.Draws))
+
+	return nm.Quo(nm, o.float().SetInt(o.Keyspace))
+}
+
+// Birthday returns the approximate probability that any two of the issued
+// tokens are the same, 1 - e^(-N(N-1)/2K); this is the classic birthday
+// problem, and it is independent of the draws.
+func (o *Odds) Birthday() *big.Float {
+	pairs := new(big.Int).Mul(o.Issued, new(big.Int).Sub(o.Issued, big.NewInt(1)))
+	pairs.Rsh(pairs, 1)
+	x := o.float().Quo(o.float().SetInt(pairs), o.float().SetInt(o.Keyspace))
+
+	return o.float().Sub(o.float().SetInt64(1), Exp(x.Neg(x)))
+}
+
+// DrawsFor returns the fewest draws needed for the probability that at
+// least one draw hits an issued token to reach the given target, i.e. the
+// smallest M w/ 1 - (1 - N/K)^M >= p; it returns nil if the target can't be
+// reached (i.e. it is not in (0, 1), or nothing is issued).
+func (o *Odds) DrawsFor(target float64) *big.Int {
+	q := o.hitRate()
+	if target <= 0 || target >= 1 || q.Sign() <= 0 {
+		return nil
+	}
+
+	if q.Cmp(big.NewFloat(1)) == 0 {
+		return big.NewInt(1)
+	}
+
+	// M = ln(1 - p) / ln(1 - q), rounded up.
+	one := o.float().SetInt64(1)
+	num := Log(o.float().Sub(one, o.float().SetFloat64(target)))
+	den := Log(o.float().Sub(one, q))
+	m := o.float().Quo(num, den)
+
+	draws, acc := m.Int(nil)
+	if acc == big.Below {
+		draws.Add(draws, big.NewInt(1))
+	}
+
+	return draws
+}
+
+// Raise x to the non-negative integer power n, by squaring.
+func pow(x *big.Float, n *big.Int) *big.Float {
+	result := new(big.Float).SetPrec(x.Prec()).SetInt64(1)
+	base := new(big.Float).Copy(x)
+	for i := 0; i < n.BitLen(); i++ {
+		if n.Bit(i) == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+	}
+
+	return result
+}
@@ -0,0 +1,109 @@
+// Package odds_test provides tests for the odds package.
+package odds_test
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/internal/odds"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogExp(t *testing.T) {
+	t.Parallel()
+	for _, x := range []float64{1e-30, 0.001, 0.5, 1, 2, math.E, 10, 12345.678, 1e40} {
+		f := new(big.Float).SetPrec(256).SetFloat64(x)
+		ln, _ := odds.Log(f).Float64()
+		assert.InEpsilon(t, math.Log(x)+1, ln+1, 1e-12, "unexpected ln(%g)", x)
+	}
+
+	for _, x := range []float64{-700, -30, -1, -1e-20, 0, 1e-20, 0.5, 1, 30, 700} {
+		f := new(big.Float).SetPrec(256).SetFloat64(x)
+		exp, _ := odds.Exp(f).Float64()
+		assert.InEpsilon(t, math.Exp(x), exp, 1e-12, "unexpected e^%g", x)
+	}
+
+	zero, _ := odds.Exp(new(big.Float).SetFloat64(-1e12)).Float64()
+	assert.Zero(t, zero)
+}
+
+func TestParseCount(t *testing.T) {
+	t.Parallel()
+	// 2^64 + 1, which a float64 (or a big.Float w/ the default precision)
+	// would round to 2^64.
+	aboveUint64 := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1))
+	testcases := []struct {
+		name  string
+		count string
+		want  *big.Int
+	}{
+		{name: "whole", count: "1000", want: big.NewInt(1000)},
+		{name: "scientific", count: "1e9", want: big.NewInt(1e9)},
+		{name: "fractional mantissa", count: "2.5e3", want: big.NewInt(2500)},
+		{name: "above 2^64", count: aboveUint64.String(), want: aboveUint64},
+		{name: "above 2^64, scientific", count: "18446744073709551617e0", want: aboveUint64},
+		{name: "huge", count: "1e40", want: new(big.Int).Exp(big.NewInt(10), big.NewInt(40), nil)},
+		{name: "fractional", count: "1.5", want: nil},
+		{name: "negative", count: "-1", want: nil},
+		{name: "not a number", count: "many", want: nil},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			n, err := odds.ParseCount(tc.count)
+			if tc.want == nil {
+				assert.Error(t, err, "expected an error parsing '%s'", tc.count)
+
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, 0, tc.want.Cmp(n), "unexpected count: %s", n)
+			}
+		})
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 30, odds.RandomSymbols(schema.GitHubPAT))
+	assert.Equal(t, 70, odds.RandomSymbols(schema.GitHubRefresh))
+	assert.Equal(t, 22+59-6, odds.RandomSymbols(schema.GitHubFineGrainedPAT))
+
+	want := new(big.Int).Exp(big.NewInt(62), big.NewInt(30), nil)
+	assert.Equal(t, 0, want.Cmp(odds.Keyspace(schema.GitHubPAT)))
+}
+
+func TestOdds(t *testing.T) {
+	t.Parallel()
+	// K = 100, N = 10, M = 5: each draw hits w/ probability 0.1.
+	o := odds.New(big.NewInt(100), big.NewInt(10), big.NewInt(5))
+
+	exact, _ := o.Exact().Float64()
+	assert.InEpsilon(t, 1-math.Pow(0.9, 5), exact, 1e-12)
+
+	approx, _ := o.Approx().Float64()
+	assert.InEpsilon(t, 1-math.Exp(-0.5), approx, 1e-12)
+
+	expected, _ := o.Expected().Float64()
+	assert.InEpsilon(t, 0.5, expected, 1e-12)
+
+	birthday, _ := o.Birthday().Float64()
+	assert.InEpsilon(t, 1-math.Exp(-45.0/100), birthday, 1e-12)
+
+	// ln(0.5)/ln(0.9) = 6.58, so 7 draws are needed.
+	assert.Equal(t, int64(7), o.DrawsFor(0.5).Int64())
+	assert.Nil(t, o.DrawsFor(1))
+	assert.Nil(t, odds.New(big.NewInt(100), big.NewInt(0), big.NewInt(5)).DrawsFor(0.5))
+
+	// at scale, the exact and approximate odds agree, and neither rounds to 0
+	// or 1.
+	k := odds.Keyspace(schema.GitHubPAT)
+	scaled := odds.New(k, big.NewInt(1e9), big.NewInt(1e9))
+	exact, _ = scaled.Exact().Float64()
+	approx, _ = scaled.Approx().Float64()
+	assert.InEpsilon(t, 1e18/5.912e53, exact, 1e-3)
+	assert.InEpsilon(t, exact, approx, 1e-9)
+}
@@ -0,0 +1,183 @@
+// Package report provides a writer for the records reported by cli commands
+// (e.g. scan findings), in formats for people and for other tools alike.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+)
+
+// Format is the format of a report.
+type Format string
+
+const (
+	// Table is a human readable table, w/ aligned columns.
+	Table Format = "table"
+	// JSON is a pretty-printed json document per record.
+	JSON Format = "json"
+	// JSONL is a compact json document per line, per record.
+	JSONL Format = "jsonl"
+	// CSV is comma separated values, w/ a header row.
+	CSV Format = "csv"
+	// SARIF is a single SARIF 2.1.0 log, w/ a result per record.
+	SARIF Format = "sarif"
+)
+
+// Formats returns the names of every format, for validating and documenting
+// the choice of format.
+func Formats() []string {
+	return []string{string(Table), string(JSON), string(JSONL), string(CSV), string(SARIF)}
+}
+
+// Record is a record of a report; the json formats write the record itself,
+// w/ encoding/json.
+type Record interface {
+	// Row returns the columns of the record, for the table and csv formats, in
+	// the order of the report's header.
+	Row() []string
+	// Result returns the record as a SARIF result.
+	Result() Result
+}
+
+// Writer writes records in a format; records are written as they come,
+// except for formats that are written at once (i.e. tables, to align their
+// columns, and SARIF logs), so Flush must be called once every record has
+// been written. A Writer isn't safe for concurrent use.
+type Writer struct {
+	w       io.Writer
+	format  Format
+	header  []string
+	tool    Tool
+	table   *tabwriter.Writer
+	csv     *csv.Writer
+	jsonl   *json.Encoder
+	results []Result
+	began   bool
+}
+
+// NewWriter returns a Writer that writes records to the given writer in the
+// given format; the header names the columns of the rows of records, and the
+// tool describes the tool, and the rules of it's results, for SARIF.
+func NewWriter(w io.Writer, format Format, header []string, tool Tool) (*Writer, error) {
+	rw := &Writer{
+		w:       w,
+		format:  format,
+		header:  header,
+		tool:    tool,
+		table:   nil,
+		csv:     nil,
+		jsonl:   nil,
+		results: make([]Result, 0),
+		began:   false,
+	}
+
+	switch format {
+	case Table:
+		rw.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0) //nolint:gomnd
+	case CSV:
+		rw.csv = csv.NewWriter(w)
+	case JSONL:
+		rw.jsonl = json.NewEncoder(w)
+	case JSON, SARIF:
+	default:
+		return nil, fmt.Errorf("unknown report format '%s', expected one of: %s", format, strings.Join(Formats(), ", "))
+	}
+
+	return rw, nil
+}
+
+// Write writes the given record.
+func (rw *Writer) Write(r Record) error {
+	if err := rw.begin(); err != nil {
+		return err
+	}
+
+	var err error
+	switch rw.format {
+	case Table:
+		_, err = fmt.Fprintln(rw.table, strings.Join(tableCells(r.Row()), "\t"))
+	case CSV:
+		err = rw.csv.Write(r.Row())
+	case JSON:
+		err = fileutil.WriteJSON(rw.w, r)
+	case JSONL:
+		err = rw.jsonl.Encode(r)
+	case SARIF:
+		rw.results = append(rw.results, r.Result())
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing record: %w", err)
+	}
+
+	return nil
+}
+
+// Flush writes anything that has yet to be written, i.e. tables, and SARIF
+// logs; a report w/o records is still written, as a table or csv of just the
+// header, or a SARIF log w/o results.
+func (rw *Writer) Flush() error {
+	if err := rw.begin(); err != nil {
+		return err
+	}
+
+	var err error
+	switch rw.format {
+	case Table:
+		err = rw.table.Flush()
+	case CSV:
+		rw.csv.Flush()
+		err = rw.csv.Error()
+	case SARIF:
+		err = rw.writeSARIF()
+	case JSON, JSONL:
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+
+	return nil
+}
+
+// Write the header, the first time a record is written, or the report is
+// flushed.
+func (rw *Writer) begin() error {
+	if rw.began {
+		return nil
+	}
+	rw.began = true
+
+	var err error
+	switch rw.format {
+	case Table:
+		_, err = fmt.Fprintln(rw.table, strings.Join(tableCells(rw.header), "\t"))
+	case CSV:
+		err = rw.csv.Write(rw.header)
+	case JSON, JSONL, SARIF:
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing header: %w", err)
+	}
+
+	return nil
+}
+
+// Return the given cells, w/ empty cells replaced by '-', and tabs and line
+// breaks replaced by spaces, so they don't break the table's columns.
+func tableCells(row []string) []string {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		cell = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(cell)
+		if len(cell) < 1 {
+			cell = "-"
+		}
+		cells[i] = cell
+	}
+
+	return cells
+}
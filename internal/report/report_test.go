@@ -0,0 +1,168 @@
+// Package report_test provides tests for the report package.
+package report_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/internal/report"
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (r record) Row() []string {
+	return []string{r.Name, r.Value}
+}
+
+func (r record) Result() report.Result {
+	return report.Result{
+		RuleID:              "rule",
+		Level:               "",
+		Message:             report.Message{Text: r.Name + "=" + r.Value},
+		Locations:           []report.Location{report.NewLocation("dir/a file", 2, 3, 4)},
+		PartialFingerprints: nil,
+		Properties:          nil,
+	}
+}
+
+var (
+	header  = []string{"name", "value"}
+	records = []record{{Name: "a", Value: "1"}, {Name: "b,\"c\"", Value: ""}}
+	tool    = report.Tool{
+		Name:           "tool",
+		Version:        "",
+		InformationURI: "",
+		Rules: []report.Rule{{
+			ID:                   "rule",
+			ShortDescription:     report.Message{Text: "a rule"},
+			DefaultConfiguration: report.Configuration{Level: report.LevelError},
+		}},
+	}
+)
+
+func write(t *testing.T, format report.Format, records []record) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := report.NewWriter(&buf, format, header, tool)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, r := range records {
+		if !assert.NoError(t, w.Write(r)) {
+			t.FailNow()
+		}
+	}
+	if !assert.NoError(t, w.Flush()) {
+		t.FailNow()
+	}
+
+	return buf.String()
+}
+
+func TestFormats(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		name    string
+		format  report.Format
+		records []record
+		check   func(t *testing.T, out string)
+	}{
+		{
+			name: "table", format: report.Table, records: records,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				assert.Equal(t, "name   value\na      1\nb,\"c\"  -\n", out, "unexpected table")
+			},
+		},
+		{
+			name: "empty table", format: report.Table, records: nil,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				assert.Equal(t, "name  value\n", out, "unexpected table")
+			},
+		},
+		{
+			name: "csv", format: report.CSV, records: records,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+				assert.NoError(t, err)
+				assert.Equal(t, [][]string{header, records[0].Row(), records[1].Row()}, rows, "unexpected csv")
+			},
+		},
+		{
+			name: "jsonl", format: report.JSONL, records: records,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if !assert.Len(t, lines, len(records)) {
+					return
+				}
+				for i, line := range lines {
+					var r record
+					assert.NoError(t, json.Unmarshal([]byte(line), &r))
+					assert.Equal(t, records[i], r, "unexpected record")
+				}
+			},
+		},
+		{
+			name: "json", format: report.JSON, records: records,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				dec := json.NewDecoder(strings.NewReader(out))
+				for _, expected := range records {
+					var r record
+					assert.NoError(t, dec.Decode(&r))
+					assert.Equal(t, expected, r, "unexpected record")
+				}
+				assert.False(t, dec.More(), "unexpected trailing records")
+			},
+		},
+		{
+			name: "sarif", format: report.SARIF, records: records,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				var log struct {
+					Version string `json:"version"`
+					Runs    []struct {
+						Tool struct {
+							Driver report.Tool `json:"driver"`
+						} `json:"tool"`
+						Results []report.Result `json:"results"`
+					} `json:"runs"`
+				}
+				if !assert.NoError(t, json.Unmarshal([]byte(out), &log)) || !assert.Len(t, log.Runs, 1) {
+					return
+				}
+				assert.Equal(t, "2.1.0", log.Version, "unexpected version")
+				assert.Equal(t, tool, log.Runs[0].Tool.Driver, "unexpected tool")
+				assert.Equal(t, []report.Result{records[0].Result(), records[1].Result()}, log.Runs[0].Results, "unexpected results")
+				assert.Equal(t, "dir/a%20file", log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI, "unexpected uri")
+			},
+		},
+		{
+			name: "empty sarif", format: report.SARIF, records: nil,
+			check: func(t *testing.T, out string) {
+				t.Helper()
+				assert.Contains(t, out, `"results": []`, "expected empty results")
+			},
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.check(t, write(t, tc.format, tc.records))
+		})
+	}
+
+	_, err := report.NewWriter(&bytes.Buffer{}, report.Format("xml"), header, tool)
+	assert.Error(t, err, "expected an error for an unknown format")
+}
@@ -0,0 +1,144 @@
+// Package report provides a writer for the records reported by cli commands
+// (e.g. scan findings), in formats for people and for other tools alike.
+// This section of the report package holds the subset of SARIF 2.1.0 that
+// results are reported in.
+package report
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Levels of SARIF results.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+)
+
+// Tool describes the tool that produced the results of a SARIF log, and the
+// rules they're reported under.
+type Tool struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+// Rule is a rule of a tool, that results are reported under.
+type Rule struct {
+	ID                   string        `json:"id"`
+	ShortDescription     Message       `json:"shortDescription"`
+	DefaultConfiguration Configuration `json:"defaultConfiguration"`
+}
+
+// Configuration is the configuration of a rule; results are at the rule's
+// level, unless they say otherwise.
+type Configuration struct {
+	Level string `json:"level"`
+}
+
+// Message is the text of a rule or result.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is a result of a SARIF log.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level,omitempty"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// PartialFingerprints identify the result across runs, e.g. so a code
+	// scanning dashboard can tell a new result from one it has seen.
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]any    `json:"properties,omitempty"`
+}
+
+// Location is the location of a result.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a location within a file.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation is the location of a file, as a URI; relative paths are
+// relative to the root of the scan.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a region of a file; lines and columns are 1-based, and the end
+// column is exclusive.
+type Region struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// NewLocation returns the location of the given length of text at the given
+// line and column of the file at the given path.
+func NewLocation(path string, line, column, length int) Location {
+	uri := url.URL{Path: filepath.ToSlash(path)} //nolint:exhaustruct
+	if filepath.IsAbs(path) {
+		uri.Scheme = "file"
+	}
+
+	return Location{
+		PhysicalLocation: PhysicalLocation{
+			ArtifactLocation: ArtifactLocation{URI: uri.String()},
+			Region:           &Region{StartLine: line, StartColumn: column, EndColumn: column + length},
+		},
+	}
+}
+
+// sarifLog is a SARIF log, w/ a single run.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun is a run of a tool, along w/ it's results.
+type sarifRun struct {
+	Tool       sarifTool `json:"tool"`
+	ColumnKind string    `json:"columnKind"`
+	Results    []Result  `json:"results"`
+}
+
+// sarifTool wraps the driver of a run, i.e. the tool itself.
+type sarifTool struct {
+	Driver Tool `json:"driver"`
+}
+
+// Write the results as a SARIF log.
+func (rw *Writer) writeSARIF() error {
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: rw.tool},
+			// columns count bytes, which only matches code points on lines of
+			// ascii text.
+			ColumnKind: "unicodeCodePoints",
+			Results:    rw.results,
+		}},
+	}
+
+	enc := json.NewEncoder(rw.w)
+	enc.SetIndent("", fileutil.SpaceIndent)
+
+	return enc.Encode(log) //nolint:wrapcheck
+}
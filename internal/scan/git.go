@@ -0,0 +1,294 @@
+// Package scan provides a scanner for tokens left in files and directories.
+// This section of the scan package holds the scanner for the history of git
+// repositories, which drives the local git executable.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitField separates the fields of a commit in the output of git log.
+const gitField = "\x1f"
+
+// Commit is a commit of a git repository.
+type Commit struct {
+	SHA string `json:"sha"`
+	// Author is formatted as 'name <email>'.
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+}
+
+// gitBlob is a blob of a git repository, along w/ the first commit and path it
+// was found at.
+type gitBlob struct {
+	sha    string
+	path   string
+	commit *Commit
+}
+
+// WalkGit scans every blob reachable from any commit of the git repository at
+// the given path (i.e. every branch, tag, and other ref, and all of their
+// history), calling found w/ each finding, attributed to the first commit
+// (oldest first) and path that introduced the blob; each unique blob is
+// scanned only once, however many commits and paths it appears at. Blobs are
+// read w/ the local git executable, so no network access is needed. Paths
+// are excluded if any of their components match, and blobs that are too large
+// or binary are counted as skipped.
+func WalkGit(ctx context.Context, repo string, opts Options, found func(Finding)) (Stats, error) {
+	var stats Stats
+	blobs, err := gitBlobs(ctx, repo, opts.Exclude, "log", "--all", "--reverse", "-m", "--raw", "--no-abbrev",
+		"--no-renames", "--no-color", "-z", "--format=commit %H"+gitField+"%an <%ae>"+gitField+"%aI")
+	if err != nil {
+		return stats, err
+	}
+
+	maxSize := opts.MaxFileSize
+	if maxSize < 1 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	err = catBlobs(ctx, repo, blobs, maxSize, func(blob gitBlob, content []byte) error {
+		if content == nil || bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+			stats.Skipped++
+
+			return nil
+		}
+		stats.Files++
+
+		findings, err := scan(blob.path, bytes.NewReader(content), opts)
+		if err != nil {
+			return err
+		}
+		for _, f := range findings {
+			f.Commit = blob.commit
+			if f.Valid {
+				stats.Valid++
+			} else {
+				stats.Invalid++
+			}
+			found(f)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed reading blobs of '%s': %w", repo, err)
+	}
+
+	return stats, nil
+}
+
+// Return the unique blobs added or modified in the raw diffs output by the
+// given git command (e.g. git log, for every commit of the given repository),
+// skipping paths w/ an excluded component.
+func gitBlobs(ctx context.Context, repo string, exclude []string, args ...string) ([]gitBlob, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...) //#nosec:G204
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed running git %s: %w", args[0], err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed running git %s: %w", args[0], err)
+	}
+
+	blobs, perr := parseRawDiff(bufio.NewReader(stdout), exclude)
+	if perr != nil {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("failed running git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if perr != nil {
+		return nil, fmt.Errorf("failed parsing git %s: %w", args[0], perr)
+	}
+
+	return blobs, nil
+}
+
+// Parse raw diffs separated by NULs, optionally of commits (i.e. git log),
+// into the unique blobs added or modified; a field is either a commit, the
+// metadata of a file's change (':old-mode new-mode old-sha new-sha status'),
+// or the path of the change before it. Blobs of changes that aren't part of a
+// commit (e.g. staged changes) have no commit.
+func parseRawDiff(r *bufio.Reader, exclude []string) ([]gitBlob, error) {
+	blobs := make([]gitBlob, 0)
+	seen := make(map[string]bool)
+	var commit *Commit
+	var change []string
+	for {
+		field, err := r.ReadString(0)
+		if errors.Is(err, io.EOF) && len(field) < 1 {
+			return blobs, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err //nolint:wrapcheck
+		}
+		field = strings.TrimPrefix(strings.TrimSuffix(field, "\x00"), "\n")
+
+		switch {
+		case change != nil:
+			sha, mode, status := change[3], change[1], change[4]
+			change = nil
+			if status == "D" || mode == "160000" || seen[sha] || excludedPath(field, exclude) {
+				continue
+			}
+			seen[sha] = true
+			blobs = append(blobs, gitBlob{sha: sha, path: field, commit: commit})
+		case strings.HasPrefix(field, "commit "):
+			c, err := parseGitCommit(strings.TrimPrefix(field, "commit "))
+			if err != nil {
+				return nil, err
+			}
+			commit = c
+		case strings.HasPrefix(field, ":"):
+			change = strings.Fields(strings.TrimPrefix(field, ":"))
+			if len(change) != 5 { //nolint:gomnd
+				return nil, fmt.Errorf("unexpected change '%s'", field)
+			}
+		case len(field) > 0:
+			return nil, fmt.Errorf("unexpected field '%s'", field)
+		}
+	}
+}
+
+// Parse a commit, formatted as 'sha<US>author<US>date'.
+func parseGitCommit(field string) (*Commit, error) {
+	parts := strings.Split(field, gitField)
+	if len(parts) != 3 { //nolint:gomnd
+		return nil, fmt.Errorf("unexpected commit '%s'", field)
+	}
+
+	date, err := time.Parse(time.RFC3339, parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected commit date: %w", err)
+	}
+
+	return &Commit{SHA: strings.Fields(parts[0])[0], Author: parts[1], Date: date}, nil
+}
+
+// Read the given blobs w/ a single git cat-file process, calling read w/ the
+// content of each, in order; the content is nil if the blob is larger than
+// the given size, or missing from the repository, and is only valid until
+// read returns.
+func catBlobs(ctx context.Context, repo string, blobs []gitBlob, maxSize int64, read func(gitBlob, []byte) error) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "cat-file", "--batch") //#nosec:G204
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed running git cat-file: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed running git cat-file: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed running git cat-file: %w", err)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(stdin)
+		var err error
+		for _, blob := range blobs {
+			if _, err = w.WriteString(blob.sha + "\n"); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if cerr := stdin.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		written <- err
+	}()
+
+	rerr := readBlobs(bufio.NewReader(stdout), blobs, maxSize, read)
+	if rerr != nil {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	werr := <-written
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed running git cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if rerr != nil {
+		return rerr
+	}
+	if werr != nil {
+		return fmt.Errorf("failed writing to git cat-file: %w", werr)
+	}
+
+	return nil
+}
+
+// Read the output of git cat-file --batch: for each blob, a header
+// ('sha type size'), followed by the content and a newline.
+func readBlobs(r *bufio.Reader, blobs []gitBlob, maxSize int64, read func(gitBlob, []byte) error) error {
+	buf := make([]byte, 0)
+	for _, blob := range blobs {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed reading blob '%s': %w", blob.sha, err)
+		}
+		parts := strings.Fields(header)
+		if len(parts) == 2 && parts[0] == blob.sha && parts[1] == "missing" { //nolint:gomnd
+			// e.g. a partial clone, that never fetched the blob.
+			if err := read(blob, nil); err != nil {
+				return err
+			}
+
+			continue
+		}
+		if len(parts) != 3 || parts[0] != blob.sha || parts[1] != "blob" { //nolint:gomnd
+			return fmt.Errorf("unexpected blob '%s': %s", blob.sha, strings.TrimSpace(header))
+		}
+		size, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected blob size '%s': %w", parts[2], err)
+		}
+
+		var content []byte
+		if size > maxSize {
+			_, err = io.CopyN(io.Discard, r, size+1)
+		} else {
+			buf = slices.Grow(buf[:0], int(size)+1)[:size+1]
+			_, err = io.ReadFull(r, buf)
+			content = buf[:size]
+		}
+		if err != nil {
+			return fmt.Errorf("failed reading blob '%s': %w", blob.sha, err)
+		}
+
+		if err := read(blob, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Test if any component of the given slash separated path matches any of the
+// given glob patterns.
+func excludedPath(name string, patterns []string) bool {
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		if excluded(part, patterns) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,261 @@
+// Package scan provides a scanner for tokens left in files and directories.
+// Candidates are pulled out of arbitrary text and filtered on their checksum,
+// so, unlike regex-only scanners, random strings that merely look like
+// tokens are rarely reported.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+const (
+	// DefaultMaxFileSize is the size of the largest file scanned, unless
+	// configured otherwise.
+	DefaultMaxFileSize = 10 << 20
+	// binarySniffLen is the length of the start of a file that is checked for
+	// NUL bytes, to tell binary files from text, as git does.
+	binarySniffLen = 8000
+)
+
+// ErrFound is returned when tokens w/ a valid checksum are found, so a scan
+// that finds something can fail.
+var ErrFound = errors.New("found tokens w/ a valid checksum")
+
+// DefaultExclude holds the names of the files and directories skipped while
+// walking, unless configured otherwise.
+var DefaultExclude = []string{".git"}
+
+// Finding is a token found in a file; it never holds the token itself, only a
+// masked form of it, so findings can be reported safely.
+type Finding struct {
+	Path string `json:"path"`
+	// Line and Column are 1-based; columns count bytes.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Offset is the 0-based byte offset of the token in the file.
+	Offset int64  `json:"offset"`
+	Schema string `json:"schema"`
+	Prefix string `json:"prefix"`
+	Masked string `json:"masked"`
+	// Valid is whether or not the token has a valid schema, i.e. a matching
+	// checksum.
+	Valid bool `json:"valid"`
+	// Commit is the commit that introduced the token, when scanning the
+	// history of a git repository.
+	Commit *Commit `json:"commit,omitempty"`
+	// token is the SHA-256 of the full token, which is never kept in the
+	// clear.
+	token [sha256.Size]byte
+}
+
+// Fingerprint returns a hash of the full token, it's path and, when scanning
+// the history of a git repository, it's commit, so findings can be told apart
+// across runs w/o leaving a guessable fragment of the token (i.e. it's mask)
+// as their identity.
+func (f Finding) Fingerprint() string {
+	h := sha256.New()
+	h.Write(f.token[:])
+	h.Write([]byte{0})
+	h.Write([]byte(f.Path))
+	if f.Commit != nil {
+		h.Write([]byte{0})
+		h.Write([]byte(f.Commit.SHA))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Options configures a scan.
+type Options struct {
+	// All reports every token candidate, rather than only those w/ a valid
+	// checksum.
+	All bool
+	// Exclude holds glob patterns (see filepath.Match) of the names of files
+	// and directories to skip while walking; paths given explicitly are never
+	// skipped.
+	Exclude []string
+	// MaxFileSize is the size of the largest file scanned; larger files are
+	// skipped. Defaults to DefaultMaxFileSize.
+	MaxFileSize int64
+}
+
+// Stats holds the counts of a scan.
+type Stats struct {
+	Files   int
+	Skipped int
+	Valid   int
+	Invalid int
+}
+
+// Add returns the sum of the stats and the given stats.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{Files: s.Files + o.Files, Skipped: s.Skipped + o.Skipped, Valid: s.Valid + o.Valid, Invalid: s.Invalid + o.Invalid}
+}
+
+// Scan scans the given text for tokens, reporting findings at the given path;
+// see Options.
+func Scan(path string, text []byte, opts Options) []Finding {
+	findings, _ := scan(path, bytes.NewReader(text), opts)
+
+	return findings
+}
+
+// ScanFile scans the file at the given path; ok is false if the file was
+// skipped, for being too large or binary.
+func ScanFile(path string, opts Options) ([]Finding, bool, error) {
+	maxSize := opts.MaxFileSize
+	if maxSize < 1 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	file, err := os.Open(path) //#nosec:G304
+	if err != nil {
+		return nil, false, fmt.Errorf("failed opening file: %w", err)
+	}
+
+	findings, ok, err := scanFile(path, file, maxSize, opts)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading file: %w", err)
+	}
+
+	return findings, ok, nil
+}
+
+// Scan the given open file, unless it's larger than the given size, or
+// binary.
+func scanFile(path string, file *os.File, maxSize int64, opts Options) ([]Finding, bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err //nolint:wrapcheck
+	}
+	if info.Size() > maxSize {
+		return nil, false, nil
+	}
+
+	r := bufio.NewReaderSize(file, binarySniffLen)
+	head, err := r.Peek(binarySniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err //nolint:wrapcheck
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, false, nil
+	}
+
+	findings, err := scan(path, io.LimitReader(r, maxSize), opts)
+
+	return findings, true, err
+}
+
+// Scan the text read from the given reader for tokens, w/ the streaming
+// extractor, reporting findings at the given path; unless every candidate is
+// reported, invalid candidates are dropped by the extractor, w/o allocating.
+func scan(path string, r io.Reader, opts Options) ([]Finding, error) {
+	findings := make([]Finding, 0)
+	extractOpts := []ghtoken.ExtractorOption{ghtoken.WithContext(0)}
+	if !opts.All {
+		extractOpts = append(extractOpts, ghtoken.WithValidOnly())
+	}
+
+	e := ghtoken.NewExtractor(r, extractOpts...)
+	for e.Next() {
+		x := e.Extracted()
+		findings = append(findings, Finding{
+			Path:   path,
+			Line:   x.Line,
+			Column: x.Column,
+			Offset: x.Offset,
+			Schema: x.Token.Schema,
+			Prefix: x.Token.Prefix,
+			Masked: x.Token.Mask(),
+			Valid:  x.Token.SchemaValid,
+			Commit: nil,
+			token:  sha256.Sum256([]byte(x.Token.FullToken)),
+		})
+	}
+
+	return findings, e.Err() //nolint:wrapcheck
+}
+
+// Walk scans every regular file under the given paths, calling found w/ each
+// finding, in the order files are walked (lexically, per path); files that
+// can't be read are reported to skip, and counted as skipped.
+func Walk(paths []string, opts Options, found func(Finding), skip func(path string, err error)) (Stats, error) {
+	var stats Stats
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				skip(path, err)
+				stats.Skipped++
+
+				return nil
+			}
+
+			if path != root && excluded(d.Name(), opts.Exclude) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			findings, ok, err := ScanFile(path, opts)
+			switch {
+			case err != nil:
+				skip(path, err)
+				stats.Skipped++
+			case !ok:
+				stats.Skipped++
+			default:
+				stats.Files++
+			}
+
+			for _, f := range findings {
+				if f.Valid {
+					stats.Valid++
+				} else {
+					stats.Invalid++
+				}
+				found(f)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("failed walking '%s': %w", root, err)
+		}
+	}
+
+	return stats, nil
+}
+
+// Test if the given name matches any of the given glob patterns.
+func excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, name); ok && err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+// Package scan provides a scanner for tokens left in files and directories.
+// This section of the scan package holds the scanner for the changes staged
+// in the index of a git repository, and for arbitrary streams, for pre-commit
+// hooks and pipelines.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// lineRange is a range of lines, from start, inclusive, to end, exclusive.
+type lineRange struct {
+	start int
+	end   int
+}
+
+// ScanReader scans the text read from the given reader for tokens, reporting
+// findings at the given path (e.g. 'stdin'); see Options.
+func ScanReader(path string, r io.Reader, opts Options) ([]Finding, Stats, error) {
+	var stats Stats
+	findings, err := scan(path, r, opts)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed reading '%s': %w", path, err)
+	}
+
+	stats.Files++
+	for _, f := range findings {
+		if f.Valid {
+			stats.Valid++
+		} else {
+			stats.Invalid++
+		}
+	}
+
+	return findings, stats, nil
+}
+
+// WalkStaged scans the changes staged in the index of the git repository at
+// the given path, i.e. what would be committed, calling found w/ each finding;
+// only tokens on lines the staged changes add are reported, so tokens that
+// were already committed don't block unrelated commits. Files are read from
+// the index rather than the working tree, so unstaged changes are ignored.
+// Paths are excluded if any of their components match, and files that are
+// too large or binary are counted as skipped.
+func WalkStaged(ctx context.Context, repo string, opts Options, found func(Finding)) (Stats, error) {
+	var stats Stats
+	// outside of a repository, git diff falls back to comparing files, rather
+	// than failing.
+	//#nosec:G204
+	if out, err := exec.CommandContext(ctx, "git", "-C", repo, "rev-parse", "--git-dir").CombinedOutput(); err != nil {
+		return stats, fmt.Errorf("failed running git rev-parse: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	blobs, err := gitBlobs(ctx, repo, opts.Exclude, "diff", "--cached", "--raw", "--no-abbrev", "--no-renames",
+		"--no-color", "--no-ext-diff", "-z")
+	if err != nil {
+		return stats, err
+	}
+
+	maxSize := opts.MaxFileSize
+	if maxSize < 1 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	err = catBlobs(ctx, repo, blobs, maxSize, func(blob gitBlob, content []byte) error {
+		if content == nil || bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+			stats.Skipped++
+
+			return nil
+		}
+		stats.Files++
+
+		findings, err := scan(blob.path, bytes.NewReader(content), opts)
+		if err != nil || len(findings) < 1 {
+			return err
+		}
+
+		added, err := stagedLines(ctx, repo, blob.path)
+		if err != nil {
+			return err
+		}
+		for _, f := range findings {
+			if !inRanges(f.Line, added) {
+				continue
+			}
+			if f.Valid {
+				stats.Valid++
+			} else {
+				stats.Invalid++
+			}
+			found(f)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed reading staged files of '%s': %w", repo, err)
+	}
+
+	return stats, nil
+}
+
+// Return the ranges of lines of the file at the given path that are added by
+// the changes staged in the given repository, from the headers of the hunks
+// of the staged diff ('@@ -old-start,old-count +new-start,new-count @@').
+func stagedLines(ctx context.Context, repo, path string) ([]lineRange, error) {
+	//#nosec:G204
+	cmd := exec.CommandContext(ctx, "git", "-C", repo, "diff", "--cached", "--no-renames", "--no-color",
+		"--no-ext-diff", "--unified=0", "--", ":(literal)"+path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed running git diff: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	ranges := make([]lineRange, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, len(out)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") { //nolint:gomnd
+			return nil, fmt.Errorf("unexpected hunk '%s'", line)
+		}
+		start, count, ok := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+		if !ok {
+			count = "1"
+		}
+		s, serr := strconv.Atoi(start)
+		n, nerr := strconv.Atoi(count)
+		if serr != nil || nerr != nil {
+			return nil, fmt.Errorf("unexpected hunk '%s'", line)
+		}
+		ranges = append(ranges, lineRange{start: s, end: s + n})
+	}
+
+	return ranges, nil
+}
+
+// Test if the given line is in any of the given ranges.
+func inRanges(line int, ranges []lineRange) bool {
+	for _, r := range ranges {
+		if r.start <= line && line < r.end {
+			return true
+		}
+	}
+
+	return false
+}
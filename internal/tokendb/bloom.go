@@ -0,0 +1,93 @@
+// Package tokendb provides a compact database of tokens, for collision tests.
+// This section of the tokendb package holds the bloom filter tier, which
+// answers most lookups of absent tokens w/o touching the exact tables, or
+// replaces them entirely when memory is tight.
+package tokendb
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// bloom is a bloom filter that is safe for concurrent use; bits are set w/
+// compare-and-swap, so adds never lock.
+type bloom struct {
+	words []atomic.Uint64
+	bits  uint64
+	k     int
+}
+
+// Build a bloom filter sized to hold the given number of keys at the given
+// false positive rate, i.e. w/ m = -n*ln(p)/ln(2)^2 bits and
+// k = (m/n)*ln(2) hashes.
+func newBloom(n uint64, fpr float64) *bloom {
+	if n < 1 {
+		n = 1
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	words := (uint64(m) + 63) / 64 //nolint:gomnd
+
+	return &bloom{
+		words: make([]atomic.Uint64, words),
+		bits:  words * 64, //nolint:gomnd
+		k:     k,
+	}
+}
+
+// add sets the bits of the given hash, returning false if they were all
+// already set, i.e. if the key may have been added before.
+func (b *bloom) add(h uint64) bool {
+	h1, h2 := h, mix(h)|1
+	added := false
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.bits
+		word, mask := &b.words[bit>>6], uint64(1)<<(bit&63)
+		for {
+			old := word.Load()
+			if old&mask != 0 {
+				break
+			}
+			if word.CompareAndSwap(old, old|mask) {
+				added = true
+
+				break
+			}
+		}
+	}
+
+	return added
+}
+
+// mayContain returns false if the key of the given hash was definitely never
+// added.
+func (b *bloom) mayContain(h uint64) bool {
+	h1, h2 := h, mix(h)|1
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.bits
+		if b.words[bit>>6].Load()&(uint64(1)<<(bit&63)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bytes returns the memory held by the filter.
+func (b *bloom) bytes() uint64 {
+	return uint64(len(b.words)) * 8 //nolint:gomnd
+}
+
+// Derive a second hash from a hash, for double hashing, w/ the splitmix64
+// finalizer.
+func mix(h uint64) uint64 {
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9 //nolint:gomnd
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb //nolint:gomnd
+
+	return h ^ (h >> 31) //nolint:gomnd
+}
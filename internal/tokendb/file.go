@@ -0,0 +1,413 @@
+// Package tokendb provides a compact database of tokens, for collision tests.
+// This section of the tokendb package holds the on-disk form of a database,
+// which is saved once and looked up by binary search on later runs.
+package tokendb
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// fileMagic begins every saved database, followed by the length of the json
+// header as a big-endian uint32, the header, and the keys of each set.
+const fileMagic = "TFTOKDB1"
+
+// headerLenSize is the size of the header's length.
+const headerLenSize = 4
+
+// ErrNotDatabase is returned when opening a file that isn't a saved
+// database.
+var ErrNotDatabase = errors.New("not a token database file")
+
+// ErrProfileMismatch is returned when a saved database was generated w/ a
+// different calibration profile than the one it's used w/.
+var ErrProfileMismatch = errors.New("calibration profile doesn't match the saved database")
+
+// Header describes a saved database.
+type Header struct {
+	// Seed is the seed the tokens were generated w/, or nil if they were
+	// generated w/ secure randomness.
+	Seed *int64 `json:"seed,omitempty"`
+	// Workers is the number of workers the tokens were generated by; a seeded
+	// database depends on both the seed and the number of workers.
+	Workers int `json:"workers,omitempty"`
+	// Profile is the fingerprint of the calibration profile the tokens were
+	// generated w/ (see ghtoken.Profile.Fingerprint), or empty if they
+	// weren't calibrated.
+	Profile string `json:"profile,omitempty"`
+	// Sets describes the tokens of each prefix, in the order their keys
+	// follow the header; it is filled in by Save.
+	Sets []SetHeader `json:"sets"`
+}
+
+// CheckProfile returns ErrProfileMismatch if the database wasn't generated w/
+// the calibration profile w/ the given fingerprint (empty for none), so tokens
+// generated w/ one profile are never tested against a database of another.
+func (h Header) CheckProfile(fingerprint string) error {
+	if h.Profile != fingerprint {
+		return fmt.Errorf("%w: saved w/ %s, used w/ %s", ErrProfileMismatch, profileName(h.Profile), profileName(fingerprint))
+	}
+
+	return nil
+}
+
+// Describe the profile w/ the given fingerprint.
+func profileName(fingerprint string) string {
+	if len(fingerprint) < 1 {
+		return "no profile"
+	}
+
+	return fmt.Sprintf("profile %.12s", fingerprint)
+}
+
+// SetHeader describes the saved tokens of a single prefix.
+type SetHeader struct {
+	Schema   SchemaHeader `json:"schema"`
+	KeyWidth int          `json:"keyWidth"`
+	Count    uint64       `json:"count"`
+}
+
+// SchemaHeader records the schema of saved tokens, so keys are never looked
+// up w/ a schema that lays them out differently.
+type SchemaHeader struct {
+	Name           string `json:"name"`
+	Prefix         string `json:"prefix"`
+	Segments       []int  `json:"segments"`
+	ChecksumLength int    `json:"checksumLength"`
+	Alphabet       string `json:"alphabet"`
+	Checksum       string `json:"checksum"`
+}
+
+// Build the header of a schema.
+func newSchemaHeader(s schema.Schema) SchemaHeader {
+	return SchemaHeader{
+		Name:           s.Name,
+		Prefix:         s.Prefix,
+		Segments:       s.Segments,
+		ChecksumLength: s.ChecksumLength,
+		Alphabet:       s.Alphabet,
+		Checksum:       s.Checksum.Name(),
+	}
+}
+
+// Check that the given registered schema has the layout recorded in the
+// header.
+func (h SchemaHeader) check(s schema.Schema) error {
+	if !slices.Equal(h.Segments, s.Segments) || h.ChecksumLength != s.ChecksumLength ||
+		h.Alphabet != s.Alphabet || h.Checksum != s.Checksum.Name() {
+		return fmt.Errorf("schema of prefix '%s' doesn't match the saved schema '%s'", h.Prefix, h.Name)
+	}
+
+	return nil
+}
+
+// Save writes the database to the given writer, w/ the given header (whose
+// Sets are filled in), as the keys of each prefix in sorted order; a bloom
+// filter only database holds no keys, so it can't be saved. Keys are sorted
+// in place and streamed to the writer, so saving takes little memory beyond
+// the database itself; adding to the database while it's saved fails the
+// save.
+func (db *DB) Save(w io.Writer, h Header) error {
+	if db.opts.BloomOnly {
+		return fmt.Errorf("a bloom filter only database can't be saved")
+	}
+
+	db.mu.RLock()
+	prefixes := make([]string, 0, len(db.sets))
+	for prefix := range db.sets {
+		prefixes = append(prefixes, prefix)
+	}
+	db.mu.RUnlock()
+	sort.Strings(prefixes)
+
+	sets := make([]*set, 0, len(prefixes))
+	h.Sets = make([]SetHeader, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		db.mu.RLock()
+		st := db.sets[prefix]
+		db.mu.RUnlock()
+
+		sets = append(sets, st)
+		h.Sets = append(h.Sets, SetHeader{
+			Schema:   newSchemaHeader(st.schema),
+			KeyWidth: KeyWidth(st.schema),
+			Count:    st.table.len(),
+		})
+	}
+
+	header, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed encoding database header: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	var length [headerLenSize]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(header)))
+	for _, b := range [][]byte{[]byte(fileMagic), length[:], header} {
+		if _, err := bw.Write(b); err != nil {
+			return fmt.Errorf("failed writing database: %w", err)
+		}
+	}
+
+	for i, st := range sets {
+		n, err := st.table.writeSorted(bw)
+		if err != nil {
+			return fmt.Errorf("failed writing database: %w", err)
+		}
+		if n != h.Sets[i].Count {
+			return fmt.Errorf("database was modified while being saved")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed writing database: %w", err)
+	}
+
+	return nil
+}
+
+// SaveFile saves the database to the file at the given path; see Save.
+func (db *DB) SaveFile(name string, h Header) error {
+	file, err := os.Create(name) //#nosec:G304
+	if err != nil {
+		return fmt.Errorf("failed creating database file: %w", err)
+	}
+
+	err = db.Save(file, h)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("failed closing database file: %w", cerr)
+	}
+
+	return err
+}
+
+// fixedKeys sorts fixed-width keys, back to back in a single slice.
+type fixedKeys struct {
+	keys  []byte
+	width int
+	tmp   []byte
+}
+
+// Len returns the number of keys.
+func (k fixedKeys) Len() int { return len(k.keys) / k.width }
+
+// Less compares the keys at the given indices.
+func (k fixedKeys) Less(i, j int) bool {
+	return bytes.Compare(k.keys[i*k.width:(i+1)*k.width], k.keys[j*k.width:(j+1)*k.width]) < 0
+}
+
+// Swap swaps the keys at the given indices.
+func (k fixedKeys) Swap(i, j int) {
+	a, b := k.keys[i*k.width:(i+1)*k.width], k.keys[j*k.width:(j+1)*k.width]
+	copy(k.tmp, a)
+	copy(a, b)
+	copy(b, k.tmp)
+}
+
+// Sort fixed-width keys in place.
+func sortKeys(keys []byte, width int) []byte {
+	sort.Sort(fixedKeys{keys: keys, width: width, tmp: make([]byte, width)})
+
+	return keys
+}
+
+// keyRuns is a min-heap of sorted runs of fixed-width keys, by the first key
+// of each run.
+type keyRuns struct {
+	runs  [][]byte
+	width int
+}
+
+// Len returns the number of runs.
+func (k *keyRuns) Len() int { return len(k.runs) }
+
+// Less compares the first keys of the runs at the given indices.
+func (k *keyRuns) Less(i, j int) bool {
+	return bytes.Compare(k.runs[i][:k.width], k.runs[j][:k.width]) < 0
+}
+
+// Swap swaps the runs at the given indices.
+func (k *keyRuns) Swap(i, j int) { k.runs[i], k.runs[j] = k.runs[j], k.runs[i] }
+
+// Push adds a run.
+func (k *keyRuns) Push(x any) { k.runs = append(k.runs, x.([]byte)) } //nolint:forcetypeassert
+
+// Pop removes the last run.
+func (k *keyRuns) Pop() any {
+	run := k.runs[len(k.runs)-1]
+	k.runs = k.runs[:len(k.runs)-1]
+
+	return run
+}
+
+// Write the keys of the given sorted runs to w, merged in sorted order,
+// returning the number of keys written; keys must be unique across runs.
+func mergeKeys(w io.Writer, runs [][]byte, width int) (uint64, error) {
+	h := &keyRuns{runs: make([][]byte, 0, len(runs)), width: width}
+	for _, run := range runs {
+		if len(run) > 0 {
+			h.runs = append(h.runs, run)
+		}
+	}
+	heap.Init(h)
+
+	n := uint64(0)
+	for h.Len() > 0 {
+		run := h.runs[0]
+		if _, err := w.Write(run[:width]); err != nil {
+			return n, err //nolint:wrapcheck
+		}
+		n++
+
+		if h.runs[0] = run[width:]; len(h.runs[0]) > 0 {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+
+	return n, nil
+}
+
+// File is a saved database, opened read-only; keys are looked up by binary
+// search, directly in the memory-mapped file where supported (see mapFile).
+// It is safe for concurrent use.
+type File struct {
+	Header Header
+	sets   map[string]fileSet
+	unmap  func() error
+}
+
+// fileSet holds the sorted keys of a single prefix.
+type fileSet struct {
+	schema schema.Schema
+	widths []int
+	width  int
+	keys   []byte
+}
+
+// Open opens the saved database at the given path; the schema of every
+// saved prefix must be registered w/ the same layout it was saved w/.
+func Open(name string) (*File, error) {
+	data, unmap, err := mapFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening database file: %w", err)
+	}
+
+	f, err := parseFile(data)
+	if err != nil {
+		if uerr := unmap(); uerr != nil {
+			err = errors.Join(err, uerr)
+		}
+
+		return nil, err
+	}
+	f.unmap = unmap
+
+	return f, nil
+}
+
+// Parse the contents of a saved database.
+func parseFile(data []byte) (*File, error) {
+	if len(data) < len(fileMagic)+headerLenSize || string(data[:len(fileMagic)]) != fileMagic {
+		return nil, ErrNotDatabase
+	}
+	data = data[len(fileMagic):]
+
+	length := uint64(binary.BigEndian.Uint32(data))
+	data = data[headerLenSize:]
+	if uint64(len(data)) < length {
+		return nil, fmt.Errorf("%w: truncated header", ErrNotDatabase)
+	}
+
+	//nolint:exhaustruct
+	f := &File{sets: make(map[string]fileSet)}
+	if err := json.Unmarshal(data[:length], &f.Header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotDatabase, err)
+	}
+	data = data[length:]
+
+	for _, sh := range f.Header.Sets {
+		s, ok := schema.Lookup(sh.Schema.Prefix)
+		if !ok {
+			return nil, fmt.Errorf("prefix '%s' of saved schema '%s' is not registered", sh.Schema.Prefix, sh.Schema.Name)
+		}
+		if err := sh.Schema.check(s); err != nil {
+			return nil, err
+		}
+		if sh.KeyWidth != KeyWidth(s) {
+			return nil, fmt.Errorf("%w: key width %d of prefix '%s' doesn't match it's schema", ErrNotDatabase, sh.KeyWidth, sh.Schema.Prefix)
+		}
+
+		size := sh.Count * uint64(sh.KeyWidth)
+		if uint64(len(data)) < size {
+			return nil, fmt.Errorf("%w: truncated keys of prefix '%s'", ErrNotDatabase, sh.Schema.Prefix)
+		}
+
+		f.sets[s.Prefix] = fileSet{
+			schema: s,
+			widths: segmentWidths(s),
+			width:  sh.KeyWidth,
+			keys:   data[:size],
+		}
+		data = data[size:]
+	}
+
+	return f, nil
+}
+
+// Contains returns whether or not the given token is in the database.
+func (f *File) Contains(tok string) bool {
+	s, payload, ok := schema.Match(tok)
+	if !ok || len(payload) != s.PayloadLength() {
+		return false
+	}
+
+	fs, found := f.sets[s.Prefix]
+	if !found {
+		return false
+	}
+
+	var buf [maxStackKey]byte
+	key, err := appendKey(buf[:0], fs.schema, fs.widths, payload)
+	if err != nil {
+		return false
+	}
+
+	n := len(fs.keys) / fs.width
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(fs.keys[i*fs.width:(i+1)*fs.width], key) >= 0
+	})
+
+	return i < n && bytes.Equal(fs.keys[i*fs.width:(i+1)*fs.width], key)
+}
+
+// Len returns the number of tokens in the database.
+func (f *File) Len() uint64 {
+	total := uint64(0)
+	for _, sh := range f.Header.Sets {
+		total += sh.Count
+	}
+
+	return total
+}
+
+// Close releases the file; the database can't be used afterwards.
+func (f *File) Close() error {
+	if err := f.unmap(); err != nil {
+		return fmt.Errorf("failed closing database file: %w", err)
+	}
+
+	return nil
+}
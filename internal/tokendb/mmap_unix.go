@@ -0,0 +1,54 @@
+//go:build unix
+
+// Package tokendb provides a compact database of tokens, for collision tests.
+// This section of the tokendb package holds the memory mapping of saved
+// databases, on platforms that support it.
+package tokendb
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the file at the given path into memory, read-only, returning
+// it's contents and a function that unmaps them; pages are only read from
+// disk as lookups touch them, so opening even a very large database is
+// instant.
+func mapFile(name string) ([]byte, func() error, error) {
+	file, err := os.Open(name) //#nosec:G304
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed opening file: %w", err)
+	}
+
+	data, err := mapOpen(file)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("failed closing file: %w", cerr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return unix.Munmap(data) }, nil
+}
+
+// Map the given open file into memory, read-only; the mapping outlives the
+// file.
+func mapOpen(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file info: %w", err)
+	}
+
+	if info.Size() < 1 {
+		return nil, ErrNotDatabase
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed mapping file: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,248 @@
+// Package tokendb provides a compact database of tokens, for collision tests.
+// This section of the tokendb package holds the sharded open-addressing
+// tables that hold exact keys.
+package tokendb
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+const (
+	// minShardSlots is the fewest slots a shard starts w/.
+	minShardSlots = 8
+	// maxLoadNum and maxLoadDen are the load factor (3/4) a shard grows past.
+	maxLoadNum = 3
+	maxLoadDen = 4
+)
+
+// table is a set of fixed-width keys, split into independently locked shards
+// by the high bits of each key's hash; each shard is an open-addressing hash
+// table w/ linear probing, w/ keys stored back to back and an occupancy
+// bitmap, so a key costs it's width (plus slack for the load factor) and no
+// pointers.
+type table struct {
+	width  int
+	hash   func([]byte) uint64
+	shift  uint
+	shards []shard
+}
+
+// shard is one independently locked part of a table.
+type shard struct {
+	mu    sync.RWMutex
+	keys  []byte
+	used  []uint64
+	mask  uint64
+	count uint64
+}
+
+// Build a table of keys of the given width, w/ at least the given number of
+// shards (rounded up to a power of 2), sized to hold the given number of keys
+// w/o growing.
+func newTable(width, shards int, capacity uint64, hash func([]byte) uint64) *table {
+	if shards < 1 {
+		shards = 1
+	}
+	shardBits := bits.Len(uint(shards - 1))
+
+	t := &table{
+		width:  width,
+		hash:   hash,
+		shift:  uint(64 - shardBits),
+		shards: make([]shard, 1<<shardBits),
+	}
+
+	perShard := capacity >> shardBits
+	slots := uint64(minShardSlots)
+	for slots*maxLoadNum/maxLoadDen < perShard {
+		slots <<= 1
+	}
+	for i := range t.shards {
+		t.shards[i].alloc(slots, width)
+	}
+
+	return t
+}
+
+// Allocate the slots of an empty shard.
+func (s *shard) alloc(slots uint64, width int) {
+	s.keys = make([]byte, slots*uint64(width))
+	s.used = make([]uint64, (slots+63)/64) //nolint:gomnd
+	s.mask = slots - 1
+	s.count = 0
+}
+
+// shardOf returns the shard of the given hash; shards take the high bits of
+// the hash, and slots the low bits, so they're independent.
+func (t *table) shardOf(h uint64) *shard {
+	if t.shift >= 64 { //nolint:gomnd
+		return &t.shards[0]
+	}
+
+	return &t.shards[h>>t.shift]
+}
+
+// add adds the given key w/ the given hash, returning false if it was
+// already there.
+func (t *table) add(key []byte, h uint64) bool {
+	s := t.shardOf(h)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(key, h, t.width) {
+		return false
+	}
+
+	if (s.count+1)*maxLoadDen > (s.mask+1)*maxLoadNum {
+		t.grow(s)
+	}
+	s.insert(key, h, t.width)
+
+	return true
+}
+
+// contains returns whether or not the given key w/ the given hash is in the
+// table.
+func (t *table) contains(key []byte, h uint64) bool {
+	s := t.shardOf(h)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(key, h, t.width)
+}
+
+// len returns the number of keys in the table.
+func (t *table) len() uint64 {
+	total := uint64(0)
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		total += s.count
+		s.mu.RUnlock()
+	}
+
+	return total
+}
+
+// bytes returns the memory held by the table's slots.
+func (t *table) bytes() uint64 {
+	total := uint64(0)
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		total += uint64(len(s.keys) + 8*len(s.used)) //nolint:gomnd
+		s.mu.RUnlock()
+	}
+
+	return total
+}
+
+// writeSorted writes every key in the table to w in sorted order, returning
+// the number of keys written, w/o copying the table: each shard's keys are
+// moved to the front of it's slots and sorted in place, the shards are merged
+// as they're written, and each shard is then rehashed, w/ scratch space for
+// only the largest shard's keys. Every shard is locked throughout.
+func (t *table) writeSorted(w io.Writer) (uint64, error) {
+	for i := range t.shards {
+		t.shards[i].mu.Lock()
+	}
+	defer func() {
+		for i := range t.shards {
+			t.shards[i].mu.Unlock()
+		}
+	}()
+	defer t.rehash()
+
+	runs := make([][]byte, 0, len(t.shards))
+	for i := range t.shards {
+		s := &t.shards[i]
+		runs = append(runs, sortKeys(s.compact(t.width), t.width))
+	}
+
+	return mergeKeys(w, runs, t.width)
+}
+
+// Move the keys of a locked shard to the front of it's slots, returning them;
+// the shard must be rehashed before it's used again.
+func (s *shard) compact(width int) []byte {
+	n := uint64(0)
+	for slot := uint64(0); slot <= s.mask; slot++ {
+		if s.isUsed(slot) {
+			copy(s.keys[n*uint64(width):], s.keys[slot*uint64(width):(slot+1)*uint64(width)])
+			n++
+		}
+	}
+
+	return s.keys[:n*uint64(width)]
+}
+
+// Rebuild every locked shard from the keys compacted to the front of it's
+// slots.
+func (t *table) rehash() {
+	largest := uint64(0)
+	for i := range t.shards {
+		largest = max(largest, t.shards[i].count)
+	}
+
+	scratch := make([]byte, largest*uint64(t.width))
+	for i := range t.shards {
+		s := &t.shards[i]
+		keys := scratch[:copy(scratch, s.keys[:s.count*uint64(t.width)])]
+		clear(s.used)
+		s.count = 0
+		for off := 0; off < len(keys); off += t.width {
+			key := keys[off : off+t.width]
+			s.insert(key, t.hash(key), t.width)
+		}
+	}
+}
+
+// Double the slots of a locked shard, reinserting every key.
+func (t *table) grow(s *shard) {
+	keys, used, mask := s.keys, s.used, s.mask
+	s.alloc((mask+1)<<1, t.width)
+	for slot := uint64(0); slot <= mask; slot++ {
+		if isSet(used, slot) {
+			key := keys[slot*uint64(t.width) : (slot+1)*uint64(t.width)]
+			s.insert(key, t.hash(key), t.width)
+		}
+	}
+}
+
+// Find the given key, probing from the slot of it's hash until it, or an
+// empty slot, is found.
+func (s *shard) find(key []byte, h uint64, width int) bool {
+	for slot := h & s.mask; s.isUsed(slot); slot = (slot + 1) & s.mask {
+		if bytes.Equal(s.keys[slot*uint64(width):(slot+1)*uint64(width)], key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Insert a key that isn't in the shard into the first empty slot from the
+// slot of it's hash.
+func (s *shard) insert(key []byte, h uint64, width int) {
+	slot := h & s.mask
+	for s.isUsed(slot) {
+		slot = (slot + 1) & s.mask
+	}
+
+	copy(s.keys[slot*uint64(width):], key)
+	s.used[slot>>6] |= 1 << (slot & 63) //nolint:gomnd
+	s.count++
+}
+
+// Test if the given slot is occupied.
+func (s *shard) isUsed(slot uint64) bool {
+	return isSet(s.used, slot)
+}
+
+// Test if the given bit of a bitmap is set.
+func isSet(bitmap []uint64, i uint64) bool {
+	return bitmap[i>>6]&(1<<(i&63)) != 0 //nolint:gomnd
+}
@@ -0,0 +1,359 @@
+// Package tokendb provides a compact database of tokens, for collision tests
+// at the scale of billions of tokens. Rather than the full token string, each
+// token is kept as a fixed-width binary key: the decoded random segments of
+// it's payload, which is enough since the checksum is derived from them.
+// Keys are held in sharded open-addressing tables (one per prefix), and an
+// optional bloom filter tier answers most lookups of absent tokens, or
+// replaces the tables entirely when memory is tight.
+package tokendb
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pyqlsa/token-forge/pkg/base62"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// DefaultShards is the number of shards of each table, unless configured
+// otherwise.
+const DefaultShards = 64
+
+// maxStackKey is the widest key that is built w/o allocating.
+const maxStackKey = 128
+
+// ErrInvalidToken is returned when a token doesn't have the layout of a
+// registered schema.
+var ErrInvalidToken = errors.New("token doesn't have the layout of a registered schema")
+
+// Options configures a DB.
+type Options struct {
+	// Shards is the number of independently locked shards of each table,
+	// rounded up to a power of 2; more shards means less contention between
+	// concurrent adds. Defaults to DefaultShards.
+	Shards int
+	// Capacity is the number of tokens the database is expected to hold; it
+	// sizes the bloom filter, and presizes the tables of Prefixes so they
+	// needn't grow while loading.
+	Capacity uint64
+	// Prefixes are the prefixes of the tokens the database is expected to
+	// hold; Capacity is split evenly among their tables. Tables of other
+	// prefixes are created as needed.
+	Prefixes []string
+	// BloomFPR is the false positive rate of the bloom filter tier, at
+	// Capacity tokens; 0 disables the tier.
+	BloomFPR float64
+	// BloomOnly keeps only the bloom filter tier, w/o the exact tables, in a
+	// fraction of the memory; lookups may then be false positives, and adds
+	// may mistake a new token for a duplicate, at the bloom filter's false
+	// positive rate. It requires a BloomFPR.
+	BloomOnly bool
+}
+
+// DB is a set of tokens; it is safe for concurrent use.
+type DB struct {
+	opts  Options
+	seed  maphash.Seed
+	mu    sync.RWMutex
+	sets  map[string]*set
+	bloom *bloom
+	// bloomLen is the number of tokens added to a bloom filter only DB.
+	bloomLen atomic.Uint64
+}
+
+// set holds the tokens of a single prefix.
+type set struct {
+	schema schema.Schema
+	// widths holds the key width of each random segment of the schema.
+	widths []int
+	// salt distinguishes the keys of the prefix in the shared bloom filter.
+	salt  uint64
+	table *table
+}
+
+// New returns an empty database; see Options.
+func New(opts Options) (*DB, error) {
+	if opts.Shards < 1 {
+		opts.Shards = DefaultShards
+	}
+
+	switch {
+	case opts.BloomFPR < 0 || opts.BloomFPR >= 1:
+		return nil, fmt.Errorf("bloom filter false positive rate must be at least 0 and less than 1")
+	case opts.BloomOnly && opts.BloomFPR == 0:
+		return nil, fmt.Errorf("a bloom filter only database needs a bloom filter false positive rate")
+	}
+
+	//nolint:exhaustruct
+	db := &DB{
+		opts: opts,
+		seed: maphash.MakeSeed(),
+		sets: make(map[string]*set),
+	}
+
+	if opts.BloomFPR > 0 {
+		db.bloom = newBloom(opts.Capacity, opts.BloomFPR)
+	}
+
+	for _, prefix := range opts.Prefixes {
+		s, ok := schema.Lookup(prefix)
+		if !ok {
+			return nil, fmt.Errorf("prefix '%s' is not a valid token prefix", prefix)
+		}
+		db.sets[prefix] = db.newSet(s, opts.Capacity/uint64(len(opts.Prefixes)))
+	}
+
+	return db, nil
+}
+
+// KeyWidth returns the width of the binary keys of tokens of the given
+// schema, i.e. the bytes needed to hold the value of each of it's random
+// segments.
+func KeyWidth(s schema.Schema) int {
+	width := 0
+	for _, w := range segmentWidths(s) {
+		width += w
+	}
+
+	return width
+}
+
+// Return the key width of each random segment of the given schema.
+func segmentWidths(s schema.Schema) []int {
+	widths := make([]int, len(s.Segments))
+	for i, length := range s.Segments {
+		if i == len(s.Segments)-1 {
+			length -= s.ChecksumLength
+		}
+		widths[i] = base62.DecodedLen(length)
+	}
+
+	return widths
+}
+
+// Build the set of the given schema, presized to hold the given number of
+// keys.
+func (db *DB) newSet(s schema.Schema, capacity uint64) *set {
+	st := &set{
+		schema: s,
+		widths: segmentWidths(s),
+		salt:   maphash.String(db.seed, s.Prefix),
+		table:  nil,
+	}
+
+	if !db.opts.BloomOnly {
+		st.table = newTable(KeyWidth(s), db.opts.Shards, capacity, db.hash)
+	}
+
+	return st
+}
+
+// Hash a key.
+func (db *DB) hash(key []byte) uint64 {
+	return maphash.Bytes(db.seed, key)
+}
+
+// Get the set of the given prefix, creating it if needed.
+func (db *DB) set(s schema.Schema) *set {
+	db.mu.RLock()
+	st, found := db.sets[s.Prefix]
+	db.mu.RUnlock()
+	if found {
+		return st
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if st, found = db.sets[s.Prefix]; !found {
+		st = db.newSet(s, 0)
+		db.sets[s.Prefix] = st
+	}
+
+	return st
+}
+
+// Append the key of the given payload to dst, decoding each random segment
+// of the schema to the given width; the payload is assumed to have the
+// layout of the schema.
+func appendKey(dst []byte, s schema.Schema, widths []int, payload string) ([]byte, error) {
+	codec := s.Codec()
+	start := 0
+	for i, width := range widths {
+		length := s.Segments[i]
+		if i == len(widths)-1 {
+			length -= s.ChecksumLength
+		}
+
+		var err error
+		if dst, err = codec.AppendDecodeWidth(dst, payload[start:start+length], width); err != nil {
+			return dst, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		start += length + len(schema.Sep)
+	}
+
+	return dst, nil
+}
+
+// Resolve the set and key of a token; ok is false if the token's prefix
+// isn't registered, and an error is returned if the token's payload doesn't
+// have the layout of it's schema.
+func (db *DB) resolve(dst []byte, tok string, create bool) (*set, []byte, bool, error) {
+	s, payload, ok := schema.Match(tok)
+	if !ok || len(payload) != s.PayloadLength() {
+		return nil, dst, false, ErrInvalidToken
+	}
+
+	var st *set
+	if create {
+		st = db.set(s)
+	} else {
+		db.mu.RLock()
+		st, ok = db.sets[s.Prefix]
+		db.mu.RUnlock()
+		if !ok {
+			return nil, dst, false, nil
+		}
+	}
+
+	key, err := appendKey(dst, st.schema, st.widths, payload)
+
+	return st, key, true, err
+}
+
+// Add adds the given token, returning false if it was already there; the
+// checksum of the token isn't validated. ErrInvalidToken is returned if the
+// token doesn't have the layout of a registered schema.
+func (db *DB) Add(tok string) (bool, error) {
+	var buf [maxStackKey]byte
+	st, key, _, err := db.resolve(buf[:0], tok, true)
+	if err != nil {
+		return false, err
+	}
+
+	h := db.hash(key)
+	if db.bloom != nil {
+		added := db.bloom.add(h ^ st.salt)
+		if db.opts.BloomOnly {
+			if added {
+				db.bloomLen.Add(1)
+			}
+
+			return added, nil
+		}
+	}
+
+	return st.table.add(key, h), nil
+}
+
+// Contains returns whether or not the given token is in the database; for a
+// bloom filter only database, it may be a false positive. Tokens that don't
+// have the layout of a registered schema are never in the database.
+func (db *DB) Contains(tok string) bool {
+	var buf [maxStackKey]byte
+	st, key, ok, err := db.resolve(buf[:0], tok, false)
+	if !ok || err != nil {
+		return false
+	}
+
+	h := db.hash(key)
+	if db.bloom != nil && !db.bloom.mayContain(h^st.salt) {
+		return false
+	}
+
+	if db.opts.BloomOnly {
+		return true
+	}
+
+	return st.table.contains(key, h)
+}
+
+// Len returns the number of tokens in the database.
+func (db *DB) Len() uint64 {
+	if db.opts.BloomOnly {
+		return db.bloomLen.Load()
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	total := uint64(0)
+	for _, st := range db.sets {
+		total += st.table.len()
+	}
+
+	return total
+}
+
+// Bytes returns the memory held by the database's tables and bloom filter.
+func (db *DB) Bytes() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	total := uint64(0)
+	if db.bloom != nil {
+		total += db.bloom.bytes()
+	}
+	for _, st := range db.sets {
+		if st.table != nil {
+			total += st.table.bytes()
+		}
+	}
+
+	return total
+}
+
+// Load adds n tokens to the database w/ the given number of concurrent
+// workers (or one per cpu, if < 1), returning the number of tokens that
+// were already there. Each worker draws tokens from it's own source, which
+// is built (in order) by calling the given function w/ the worker's index,
+// and adds a fixed share of the tokens; so, deterministic sources load the
+// same tokens regardless of scheduling.
+func (db *DB) Load(n uint64, workers int, source func(worker int) func() string) (uint64, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		dups     atomic.Uint64
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	share, extra := n/uint64(workers), n%uint64(workers)
+	for w := 0; w < workers; w++ {
+		count := share
+		if uint64(w) < extra {
+			count++
+		}
+		next := source(w)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); i < count; i++ {
+				added, err := db.Add(next())
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+
+					return
+				}
+				if !added {
+					dups.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return dups.Load(), fmt.Errorf("failed loading tokens: %w", firstErr)
+	}
+
+	return dups.Load(), nil
+}
@@ -0,0 +1,277 @@
+// Package tokendb_test provides tests for the tokendb package.
+package tokendb_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/internal/tokendb"
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a source of tokens w/ the given prefix, seeded w/ the given seed.
+func seededSource(seed int64, prefix string) func() string {
+	gen := ghtoken.NewSeededGenerator(seed)
+
+	return func() string {
+		return gen.Generate(prefix).FullToken
+	}
+}
+
+func TestKeyWidth(t *testing.T) {
+	t.Parallel()
+	ghp, _ := schema.Lookup("ghp")
+	pat, _ := schema.Lookup("github_pat")
+	// 30 symbols need 23 bytes; 22 and 53 symbols need 17 and 40 bytes.
+	assert.Equal(t, 23, tokendb.KeyWidth(ghp))
+	assert.Equal(t, 57, tokendb.KeyWidth(pat))
+}
+
+func TestAddContains(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		name string
+		opts tokendb.Options
+	}{
+		{name: "default", opts: tokendb.Options{}},                                           //nolint:exhaustruct
+		{name: "one shard", opts: tokendb.Options{Shards: 1}},                                //nolint:exhaustruct
+		{name: "presized", opts: tokendb.Options{Capacity: 1000, Prefixes: []string{"ghp"}}}, //nolint:exhaustruct
+		{name: "bloom tier", opts: tokendb.Options{Capacity: 1000, BloomFPR: 0.01}},          //nolint:exhaustruct
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			db, err := tokendb.New(tc.opts)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			added, absent := make([]string, 1000), make([]string, 1000)
+			genAdded, genAbsent := ghtoken.NewSeededGenerator(1), ghtoken.NewSeededGenerator(2)
+			for i := range added {
+				added[i] = genAdded.GenerateRandomPrefix().FullToken
+				absent[i] = genAbsent.GenerateRandomPrefix().FullToken
+			}
+
+			for _, tok := range added {
+				ok, err := db.Add(tok)
+				assert.NoError(t, err)
+				assert.True(t, ok, "fresh token should be added: %s", tok)
+			}
+			for _, tok := range added {
+				ok, err := db.Add(tok)
+				assert.NoError(t, err)
+				assert.False(t, ok, "duplicate token should not be added: %s", tok)
+				assert.True(t, db.Contains(tok), "added token should be found: %s", tok)
+			}
+			for _, tok := range absent {
+				assert.False(t, db.Contains(tok), "token that wasn't added should not be found: %s", tok)
+			}
+			assert.Equal(t, uint64(1000), db.Len())
+		})
+	}
+}
+
+func TestInvalidTokens(t *testing.T) {
+	t.Parallel()
+	db, err := tokendb.New(tokendb.Options{}) //nolint:exhaustruct
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for _, tok := range []string{"", "ghp_short", "zzz_c7s0WCCU63BJ4ZHMbv2WC7p3W0tsdk157BFN", "ghp_c7s0WCCU63BJ4ZHMbv2WC7p3W0tsd+157BFN"} {
+		_, err := db.Add(tok)
+		assert.ErrorIs(t, err, tokendb.ErrInvalidToken, "expected invalid token: %s", tok)
+		assert.False(t, db.Contains(tok))
+	}
+
+	_, err = tokendb.New(tokendb.Options{BloomOnly: true}) //nolint:exhaustruct
+	assert.Error(t, err, "bloom filter only w/o a false positive rate should be rejected")
+}
+
+func TestBloomOnly(t *testing.T) {
+	t.Parallel()
+	const n = 10000
+	const fpr = 0.01
+	db, err := tokendb.New(tokendb.Options{Capacity: n, BloomFPR: fpr, BloomOnly: true}) //nolint:exhaustruct
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	next := seededSource(1, "ghp")
+	for i := 0; i < n; i++ {
+		_, err := db.Add(next())
+		assert.NoError(t, err)
+	}
+	// new tokens are only mistaken for duplicates at the false positive rate.
+	assert.InDelta(t, n, db.Len(), n*fpr)
+
+	other := seededSource(2, "ghp")
+	positives := 0
+	for i := 0; i < n; i++ {
+		if db.Contains(other()) {
+			positives++
+		}
+	}
+	assert.InDelta(t, fpr, float64(positives)/n, fpr, "false positive rate should be near the configured rate")
+}
+
+func TestLoadDeterministic(t *testing.T) {
+	t.Parallel()
+	load := func(workers int) *tokendb.DB {
+		db, err := tokendb.New(tokendb.Options{}) //nolint:exhaustruct
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		dups, err := db.Load(1001, workers, func(worker int) func() string {
+			return seededSource(int64(worker), "ghp")
+		})
+		assert.NoError(t, err)
+		assert.Zero(t, dups)
+		assert.Equal(t, uint64(1001), db.Len())
+
+		return db
+	}
+
+	a, b := load(4), load(4)
+	next := seededSource(3, "ghp")
+	for i := 0; i < 250; i++ {
+		tok := next()
+		assert.Equal(t, a.Contains(tok), b.Contains(tok))
+	}
+	// worker 3 adds 250 tokens, and worker 0 adds 251.
+	check := seededSource(3, "ghp")
+	for i := 0; i < 250; i++ {
+		tok := check()
+		assert.True(t, a.Contains(tok) && b.Contains(tok), "token of a deterministic worker should be loaded: %s", tok)
+	}
+}
+
+func TestSaveOpen(t *testing.T) {
+	t.Parallel()
+	db, err := tokendb.New(tokendb.Options{Shards: 8}) //nolint:exhaustruct
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	added, absent := make([]string, 1000), make([]string, 1000)
+	genAdded, genAbsent := ghtoken.NewSeededGenerator(1), ghtoken.NewSeededGenerator(2)
+	for i := range added {
+		added[i] = genAdded.GenerateRandomPrefix().FullToken
+		absent[i] = genAbsent.GenerateRandomPrefix().FullToken
+		_, err := db.Add(added[i])
+		assert.NoError(t, err)
+	}
+
+	seed := int64(42)
+	name := filepath.Join(t.TempDir(), "tokens.db")
+	if !assert.NoError(t, db.SaveFile(name, tokendb.Header{Seed: &seed, Workers: 2, Profile: "abc"})) { //nolint:exhaustruct
+		t.FailNow()
+	}
+
+	f, err := tokendb.Open(name)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() { assert.NoError(t, f.Close()) }()
+
+	assert.Equal(t, db.Len(), f.Len())
+	assert.Equal(t, &seed, f.Header.Seed)
+	assert.Equal(t, 2, f.Header.Workers)
+	assert.NoError(t, f.Header.CheckProfile("abc"))
+	assert.ErrorIs(t, f.Header.CheckProfile(""), tokendb.ErrProfileMismatch, "a database of another profile should be rejected")
+	assert.ErrorIs(t, f.Header.CheckProfile("def"), tokendb.ErrProfileMismatch, "a database of another profile should be rejected")
+	for i := 1; i < len(f.Header.Sets); i++ {
+		assert.Less(t, f.Header.Sets[i-1].Schema.Prefix, f.Header.Sets[i].Schema.Prefix, "sets should be sorted by prefix")
+	}
+	for _, tok := range added {
+		assert.True(t, f.Contains(tok), "saved token should be found: %s", tok)
+	}
+	for _, tok := range absent {
+		assert.False(t, f.Contains(tok), "token that wasn't saved should not be found: %s", tok)
+	}
+	assert.False(t, f.Contains("ghp_short"))
+
+	// saving sorts the keys in place, so the database must be rebuilt after.
+	assert.Equal(t, f.Len(), db.Len())
+	for i := range added {
+		assert.True(t, db.Contains(added[i]), "token should be found after saving: %s", added[i])
+		assert.False(t, db.Contains(absent[i]), "token that wasn't added should not be found after saving: %s", absent[i])
+	}
+	_, err = db.Add(absent[0])
+	assert.NoError(t, err)
+	assert.True(t, db.Contains(absent[0]), "database should be usable after saving")
+}
+
+func TestOpenInvalid(t *testing.T) {
+	t.Parallel()
+	db, err := tokendb.New(tokendb.Options{}) //nolint:exhaustruct
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = db.Add(seededSource(1, "ghp")())
+	assert.NoError(t, err)
+	var saved bytes.Buffer
+	if !assert.NoError(t, db.Save(&saved, tokendb.Header{})) { //nolint:exhaustruct
+		t.FailNow()
+	}
+
+	dir := t.TempDir()
+	testcases := []struct {
+		name     string
+		contents []byte
+	}{
+		{name: "empty", contents: []byte{}},
+		{name: "bad magic", contents: []byte("NOTATOKENDATABASE")},
+		{name: "truncated header", contents: []byte("TFTOKDB1\x00\x00\x01\x00{}")},
+		{name: "bad header", contents: []byte("TFTOKDB1\x00\x00\x00\x02{]")},
+		{name: "truncated keys", contents: saved.Bytes()[:saved.Len()-1]},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			name := filepath.Join(dir, tc.name)
+			if !assert.NoError(t, os.WriteFile(name, tc.contents, 0o600)) {
+				t.FailNow()
+			}
+			_, err := tokendb.Open(name)
+			assert.ErrorIs(t, err, tokendb.ErrNotDatabase)
+		})
+	}
+
+	bloomDB, err := tokendb.New(tokendb.Options{BloomFPR: 0.01, BloomOnly: true}) //nolint:exhaustruct
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Error(t, bloomDB.Save(&saved, tokendb.Header{}), "bloom filter only database should not be saved") //nolint:exhaustruct
+}
+
+func BenchmarkAdd(b *testing.B) {
+	next := seededSource(1, "ghp")
+	tokens := make([]string, 100000)
+	for i := range tokens {
+		tokens[i] = next()
+	}
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		db := make(map[string]bool)
+		for i := 0; i < b.N; i++ {
+			db[tokens[i%len(tokens)]] = true
+		}
+	})
+
+	b.Run("tokendb", func(b *testing.B) {
+		b.ReportAllocs()
+		db, _ := tokendb.New(tokendb.Options{}) //nolint:exhaustruct
+		for i := 0; i < b.N; i++ {
+			_, _ = db.Add(tokens[i%len(tokens)])
+		}
+	})
+}
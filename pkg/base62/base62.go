@@ -0,0 +1,408 @@
+// Package base62 provides a base62 codec for arbitrary 62 symbol alphabets;
+// unlike math/big, it encodes to a fixed width, decodes strictly (reporting
+// the position of the first invalid symbol), and never needs to translate
+// between alphabets.
+//
+// Compatibility: see the ghtoken package; the same guarantees apply here.
+package base62
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+const (
+	// AlphabetSize is the number of symbols in a base62 alphabet.
+	AlphabetSize = 62
+	// BigIntAlphabet is the base62 alphabet used by Golang's big.Int package.
+	BigIntAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// GitHubAlphabet is the base62 alphabet used by GitHub (and others that
+	// follow GitHub's token design); it is the inversion of BigIntAlphabet.
+	GitHubAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// symbolsPerLimb is the number of symbols encoded from each division of
+	// 32 bit limbs; see encode.
+	symbolsPerLimb = 5
+	// maxDecodeLimbs is the most 32-bit limbs a fixed-width value is decoded
+	// into, i.e. values of up to 64 bytes; wider values are decoded a byte at
+	// a time.
+	maxDecodeLimbs = 16
+	// limbBase is 62^symbolsPerLimb.
+	limbBase = 62 * 62 * 62 * 62 * 62
+	// invalid marks bytes that aren't symbols of the alphabet in a lookup
+	// table.
+	invalid = 0xFF
+)
+
+// ErrOverflow is returned when a value doesn't fit in the requested width.
+var ErrOverflow = errors.New("value overflows requested width")
+
+// CorruptInputError is returned when decoding input w/ a symbol that isn't
+// in the codec's alphabet; it's value is the offset of the symbol.
+type CorruptInputError int64
+
+// Error returns the offset of the invalid symbol.
+func (e CorruptInputError) Error() string {
+	return "illegal base62 data at input byte " + strconv.FormatInt(int64(e), 10)
+}
+
+// Codec encodes and decodes base62 w/ a specific alphabet; the first symbol
+// of the alphabet is zero. A Codec is safe for concurrent use.
+type Codec struct {
+	alphabet string
+	table    [256]byte
+}
+
+// Codecs of the well known alphabets.
+var (
+	GitHub = MustNewCodec(GitHubAlphabet)
+	BigInt = MustNewCodec(BigIntAlphabet)
+)
+
+// NewCodec returns a codec for the given alphabet, or an error if the
+// alphabet isn't made up of 62 distinct bytes.
+func NewCodec(alphabet string) (*Codec, error) {
+	if len(alphabet) != AlphabetSize {
+		return nil, fmt.Errorf("alphabet '%s' must have %d symbols, not %d", alphabet, AlphabetSize, len(alphabet))
+	}
+
+	//nolint:exhaustruct
+	c := &Codec{
+		alphabet: alphabet,
+	}
+	for i := range c.table {
+		c.table[i] = invalid
+	}
+
+	for i := 0; i < len(alphabet); i++ {
+		if c.table[alphabet[i]] != invalid {
+			return nil, fmt.Errorf("alphabet '%s' has a duplicate symbol '%c'", alphabet, alphabet[i])
+		}
+		c.table[alphabet[i]] = byte(i)
+	}
+
+	return c, nil
+}
+
+// MustNewCodec is like NewCodec, but panics on error; only for initializing
+// package level variables.
+func MustNewCodec(alphabet string) *Codec {
+	c, err := NewCodec(alphabet)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// Alphabet returns the codec's alphabet.
+func (c *Codec) Alphabet() string {
+	return c.alphabet
+}
+
+// Valid returns whether or not the given byte is a symbol of the codec's
+// alphabet.
+func (c *Codec) Valid(b byte) bool {
+	return c.table[b] != invalid
+}
+
+// Index returns the value of the given symbol in the codec's alphabet, or -1
+// if it isn't a symbol of the alphabet.
+func (c *Codec) Index(b byte) int {
+	if c.table[b] == invalid {
+		return -1
+	}
+
+	return int(c.table[b])
+}
+
+// EncodedLen returns the most symbols needed to encode n bytes.
+func EncodedLen(n int) int {
+	return int(math.Ceil(float64(n) * 8 / math.Log2(AlphabetSize)))
+}
+
+// DecodedLen returns the fewest bytes that can hold the value of any n
+// symbols, i.e. the bytes needed for 62^n - 1.
+func DecodedLen(n int) int {
+	if n < 1 {
+		return 0
+	}
+
+	limit := new(big.Int).Exp(big.NewInt(AlphabetSize), big.NewInt(int64(n)), nil)
+
+	return (limit.Sub(limit, big.NewInt(1)).BitLen() + 7) / 8 //nolint:gomnd
+}
+
+// Encode encodes the given bytes, as a big-endian unsigned integer, w/o
+// leading zero symbols; zero (including empty input) encodes to the zero
+// symbol, same as big.Int.Text.
+func (c *Codec) Encode(src []byte) string {
+	digits := c.encode(src)
+	if len(digits) < 1 {
+		return c.alphabet[:1]
+	}
+
+	return string(digits)
+}
+
+// EncodeWidth encodes the given bytes, as a big-endian unsigned integer,
+// left-padded w/ the zero symbol to exactly the given width; ErrOverflow is
+// returned if the value needs more than width symbols.
+func (c *Codec) EncodeWidth(src []byte, width int) (string, error) {
+	digits := c.encode(src)
+	if len(digits) > width {
+		return "", ErrOverflow
+	}
+
+	out := make([]byte, width)
+	pad := width - len(digits)
+	for i := 0; i < pad; i++ {
+		out[i] = c.alphabet[0]
+	}
+	copy(out[pad:], digits)
+
+	return string(out), nil
+}
+
+// Encode the given bytes by repeated division, returning the symbols w/o
+// leading zeros; the bytes are divided as 32 bit limbs, by 62^5 (the largest
+// power of 62 that fits in 32 bits), so each pass yields 5 symbols.
+func (c *Codec) encode(src []byte) []byte {
+	var stack [16]uint32
+	limbs := stack[:0]
+	if n := (len(src) + 3) / 4; n > len(stack) {
+		limbs = make([]uint32, 0, n)
+	}
+
+	// the leading limb takes whatever bytes don't fill a whole limb.
+	for i := len(src) % 4; i <= len(src); i += 4 {
+		var limb uint32
+		for _, b := range src[max(i-4, 0):i] {
+			limb = limb<<8 | uint32(b)
+		}
+		limbs = append(limbs, limb)
+	}
+
+	digits := make([]byte, EncodedLen(len(src))+symbolsPerLimb)
+	pos := len(digits)
+	for start := 0; start < len(limbs); {
+		if limbs[start] == 0 {
+			start++
+
+			continue
+		}
+
+		var rem uint64
+		for i := start; i < len(limbs); i++ {
+			acc := rem<<32 | uint64(limbs[i])
+			limbs[i] = uint32(acc / limbBase)
+			rem = acc % limbBase
+		}
+
+		for i := 0; i < symbolsPerLimb; i++ {
+			pos--
+			digits[pos] = c.alphabet[rem%AlphabetSize]
+			rem /= AlphabetSize
+		}
+	}
+
+	for pos < len(digits) && digits[pos] == c.alphabet[0] {
+		pos++
+	}
+
+	return digits[pos:]
+}
+
+// Decode decodes the given symbols to the bytes of a big-endian unsigned
+// integer, w/o leading zero bytes, same as big.Int.Bytes; a
+// CorruptInputError is returned at the first symbol that isn't in the
+// codec's alphabet.
+func (c *Codec) Decode(s string) ([]byte, error) {
+	num, err := c.decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(num) > 0 && num[0] == 0 {
+		num = num[1:]
+	}
+
+	return num, nil
+}
+
+// DecodeWidth decodes the given symbols to the bytes of a big-endian
+// unsigned integer, left-padded w/ zeros to exactly the given number of
+// bytes; ErrOverflow is returned if the value needs more than n bytes, and a
+// CorruptInputError is returned at the first symbol that isn't in the
+// codec's alphabet.
+func (c *Codec) DecodeWidth(s string, n int) ([]byte, error) {
+	num, err := c.decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, n)
+	for i, b := range num {
+		switch {
+		case len(num)-i <= n:
+			copy(out[n-(len(num)-i):], num[i:])
+
+			return out, nil
+		case b != 0:
+			return nil, ErrOverflow
+		}
+	}
+
+	return out, nil
+}
+
+// AppendDecodeWidth appends the value of the given symbols to dst, as
+// exactly n big-endian bytes like DecodeWidth, and returns the extended
+// slice; it doesn't allocate when dst has room for n more bytes. On error,
+// dst is returned unextended.
+func (c *Codec) AppendDecodeWidth(dst []byte, s string, n int) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, make([]byte, n)...)
+
+	var err error
+	if n <= 4*maxDecodeLimbs {
+		err = c.decodeLimbs(dst[start:], s)
+	} else {
+		err = c.decodeBytes(dst[start:], s)
+	}
+	if err != nil {
+		return dst[:start], err
+	}
+
+	return dst, nil
+}
+
+// Decode the given symbols into the zeroed, fixed-width num, w/ 32-bit limbs
+// multiplied by 62^5 (i.e. symbolsPerLimb symbols at a time), which is much
+// faster than multiplying bytes by 62 one symbol at a time; num must be at
+// most 4*maxDecodeLimbs bytes.
+func (c *Codec) decodeLimbs(num []byte, s string) error {
+	var limbs [maxDecodeLimbs]uint32 // least significant first
+	n := (len(num) + 3) / 4          //nolint:gomnd
+	for i := 0; i < len(s); {
+		chunk, mul := uint64(0), uint64(1)
+		for j := 0; j < symbolsPerLimb && i < len(s); j, i = j+1, i+1 {
+			d := c.table[s[i]]
+			if d == invalid {
+				return CorruptInputError(i)
+			}
+			chunk = chunk*AlphabetSize + uint64(d)
+			mul *= AlphabetSize
+		}
+
+		carry := chunk
+		for k := 0; k < n; k++ {
+			acc := uint64(limbs[k])*mul + carry
+			limbs[k] = uint32(acc)
+			carry = acc >> 32 //nolint:gomnd
+		}
+		if carry > 0 {
+			return ErrOverflow
+		}
+	}
+
+	for b := 0; b < 4*n; b++ {
+		v := byte(limbs[b/4] >> (8 * (b % 4))) //nolint:gomnd
+		switch {
+		case b < len(num):
+			num[len(num)-1-b] = v
+		case v != 0:
+			return ErrOverflow
+		}
+	}
+
+	return nil
+}
+
+// Decode the given symbols into the zeroed, fixed-width num, by multiplying
+// bytes by 62 one symbol at a time.
+func (c *Codec) decodeBytes(num []byte, s string) error {
+	for i := 0; i < len(s); i++ {
+		d := c.table[s[i]]
+		if d == invalid {
+			return CorruptInputError(i)
+		}
+
+		carry := uint(d)
+		for j := len(num) - 1; j >= 0; j-- {
+			acc := uint(num[j])*AlphabetSize + carry
+			num[j] = byte(acc)
+			carry = acc >> 8
+		}
+		if carry > 0 {
+			return ErrOverflow
+		}
+	}
+
+	return nil
+}
+
+// Decode the given symbols by repeated multiplication, returning the value
+// as bytes, which may have leading zeros.
+func (c *Codec) decode(s string) ([]byte, error) {
+	// log2(62) < 6, so 6 bits per symbol always suffices.
+	num := make([]byte, (len(s)*6+7)/8)
+	start := len(num)
+	for i := 0; i < len(s); i++ {
+		d := c.table[s[i]]
+		if d == invalid {
+			return nil, CorruptInputError(i)
+		}
+
+		carry := uint(d)
+		for j := len(num) - 1; j >= start; j-- {
+			acc := uint(num[j])*AlphabetSize + carry
+			num[j] = byte(acc)
+			carry = acc >> 8
+		}
+		for ; carry > 0; carry >>= 8 {
+			start--
+			num[start] = byte(carry)
+		}
+	}
+
+	return num, nil
+}
+
+// DecodeUint32 decodes the given symbols as a 32 bit value, returning false
+// if the input is empty, if a byte isn't a symbol of the alphabet, or if the
+// value overflows 32 bits; leading zero symbols are permitted. It never
+// allocates.
+func (c *Codec) DecodeUint32(enc []byte) (uint32, bool) {
+	return decodeUint32(c, enc)
+}
+
+// DecodeUint32String is DecodeUint32 for strings.
+func (c *Codec) DecodeUint32String(enc string) (uint32, bool) {
+	return decodeUint32(c, enc)
+}
+
+// Decode symbols of either a string or a byte slice, w/o converting between
+// the two (which would allocate).
+func decodeUint32[T string | []byte](c *Codec, enc T) (uint32, bool) {
+	if len(enc) < 1 {
+		return 0, false
+	}
+
+	var v uint64
+	for i := 0; i < len(enc); i++ {
+		d := c.table[enc[i]]
+		if d == invalid {
+			return 0, false
+		}
+
+		v = v*AlphabetSize + uint64(d)
+		if v > math.MaxUint32 {
+			return 0, false
+		}
+	}
+
+	return uint32(v), true
+}
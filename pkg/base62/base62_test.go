@@ -0,0 +1,164 @@
+// Package base62_test provides tests for the base62 package.
+package base62_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/pkg/base62"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		name   string
+		codec  *base62.Codec
+		input  string
+		offset int64
+	}{
+		{name: "underscore", codec: base62.GitHub, input: "c7s0_WCCU", offset: 4},
+		{name: "sign", codec: base62.GitHub, input: "-c7s0", offset: 0},
+		{name: "last", codec: base62.BigInt, input: "c7s0!", offset: 4},
+		{name: "non-ascii", codec: base62.BigInt, input: "c7é", offset: 2},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := tc.codec.Decode(tc.input)
+			var corrupt base62.CorruptInputError
+			if assert.ErrorAs(t, err, &corrupt, "expected corrupt input decoding '%s'", tc.input) {
+				assert.Equal(t, tc.offset, int64(corrupt), "unexpected offset decoding '%s'", tc.input)
+			}
+		})
+	}
+}
+
+func TestWidth(t *testing.T) {
+	t.Parallel()
+	enc, err := base62.GitHub.EncodeWidth([]byte{0x00, 0x3d}, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "000z", enc)
+
+	_, err = base62.GitHub.EncodeWidth([]byte{0xff, 0xff, 0xff, 0xff}, 5)
+	assert.ErrorIs(t, err, base62.ErrOverflow)
+
+	dec, err := base62.GitHub.DecodeWidth("000z", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x3d}, dec)
+
+	_, err = base62.GitHub.DecodeWidth("zzzzzz", 4)
+	assert.ErrorIs(t, err, base62.ErrOverflow)
+
+	dst := []byte{0xaa}
+	dst, err = base62.GitHub.AppendDecodeWidth(dst, "000z", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xaa, 0x00, 0x00, 0x3d}, dst)
+
+	dst, err = base62.GitHub.AppendDecodeWidth(dst, "zzzzzz", 4)
+	assert.ErrorIs(t, err, base62.ErrOverflow)
+	assert.Len(t, dst, 4, "a failed append should leave dst unextended")
+
+	// 62^4 - 1 = 14776335 needs 3 bytes, and 62^30 - 1 needs 23.
+	assert.Equal(t, 3, base62.DecodedLen(4))
+	assert.Equal(t, 23, base62.DecodedLen(30))
+
+	_, err = base62.NewCodec(base62.GitHubAlphabet[:61] + "0")
+	assert.Error(t, err, "expected duplicate symbol to be rejected")
+}
+
+// BenchmarkEncode compares the big.Int implementation in datautil w/ the
+// codec, encoding as many bytes as generated token input.
+func BenchmarkEncode(b *testing.B) {
+	data := []byte("some twenty-three bytes")
+
+	b.Run("big", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = datautil.EncodeBase62(data, true)
+		}
+	})
+
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = base62.GitHub.EncodeWidth(data, 31)
+		}
+	})
+}
+
+// Tests that the codec agrees w/ the big.Int implementation in datautil.
+func FuzzEncode(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x00, 0x00, 0x01})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte("some twenty-three bytes"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		assert.Equal(t, datautil.EncodeBase62(data, true), base62.GitHub.Encode(data))
+		assert.Equal(t, datautil.EncodeBase62(data, false), base62.BigInt.Encode(data))
+
+		width := base62.EncodedLen(len(data))
+		enc, err := base62.GitHub.EncodeWidth(data, width)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		dec, err := base62.GitHub.DecodeWidth(enc, len(data))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, dec), "round trip of %x through '%s' gave %x", data, enc, dec)
+	})
+}
+
+// Tests that the codec agrees w/ the big.Int implementation in datautil;
+// big.Int accepts a leading sign, so only inputs where every symbol is in
+// the alphabet are compared.
+func FuzzDecode(f *testing.F) {
+	f.Add("")
+	f.Add("0")
+	f.Add("000z")
+	f.Add("c7s0WCCU63BJ4ZHMbv2WC7p3W0tsdk")
+	f.Add("+z")
+	f.Add("a_b")
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, c := range []struct {
+			codec  *base62.Codec
+			invert bool
+		}{{base62.GitHub, true}, {base62.BigInt, false}} {
+			got, err := c.codec.Decode(s)
+			strict := true
+			for i := 0; i < len(s); i++ {
+				if !c.codec.Valid(s[i]) {
+					strict = false
+					var corrupt base62.CorruptInputError
+					assert.True(t, errors.As(err, &corrupt) && int(corrupt) == i, "expected corrupt input at %d of '%s', got %v", i, s, err)
+
+					break
+				}
+			}
+			if !strict || len(s) < 1 {
+				continue
+			}
+
+			want, ok := datautil.DecodeBase62(s, 0, c.invert)
+			assert.True(t, ok, "big.Int failed decoding '%s'", s)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(want, got), "decoding '%s' gave %x, want %x", s, got, want)
+
+			width := base62.DecodedLen(len(s))
+			fixed, err := c.codec.DecodeWidth(s, width)
+			assert.NoError(t, err)
+			appended, err := c.codec.AppendDecodeWidth(nil, s, width)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(fixed, appended), "appending '%s' gave %x, want %x", s, appended, fixed)
+
+			// one byte too narrow overflows exactly when the value needs
+			// every byte.
+			_, wantErr := c.codec.DecodeWidth(s, width-1)
+			_, err = c.codec.AppendDecodeWidth(nil, s, width-1)
+			assert.Equal(t, wantErr, err, "appending '%s' w/ width %d", s, width-1)
+		}
+	})
+}
@@ -1,4 +1,6 @@
 // Package datautil provides utilities for randomness, encode/decode, etc.
+//
+// Compatibility: see the ghtoken package; the same guarantees apply here.
 package datautil
 
 import (
@@ -88,20 +90,56 @@ func flipCase(s string) string {
 	return string(split)
 }
 
+// CRC32 tables are built once, up front, rather than looked up by polynomial
+// on every checksum.
+var (
+	ieeeTable       = crc32.MakeTable(crc32.IEEE)
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
 // GenerateCrc32Uint32 calculates a CRC32 checksum of the given string,
-// returning the checksum as uint32.
+// returning the checksum as uint32; it never allocates.
 func GenerateCrc32Uint32(s string) uint32 {
-	crcTable := crc32.MakeTable(crc32.IEEE)
+	return crc32String(ieeeTable, s)
+}
+
+// Crc32Uint32Bytes calculates a CRC32 checksum of the given byte slice,
+// returning the checksum as uint32; it never allocates.
+func Crc32Uint32Bytes(b []byte) uint32 {
+	return crc32.Update(0, ieeeTable, b)
+}
 
-	return crc32.Checksum([]byte(s), crcTable)
+// GenerateCrc32cUint32 calculates a CRC32 checksum of the given string w/ the
+// Castagnoli polynomial (CRC32C), returning the checksum as uint32; it never
+// allocates.
+func GenerateCrc32cUint32(s string) uint32 {
+	return crc32String(castagnoliTable, s)
+}
+
+// Calculate the CRC32 checksum of the given string a byte at a time w/ the
+// given table, rather than converting it to the byte slice hash/crc32 wants
+// (which would allocate); tokens are short enough that the faster, sliced
+// algorithms of hash/crc32 make little difference.
+func crc32String(tab *crc32.Table, s string) uint32 {
+	crc := ^uint32(0)
+	for i := 0; i < len(s); i++ {
+		crc = tab[byte(crc)^s[i]] ^ (crc >> 8) //nolint:gomnd
+	}
+
+	return ^crc
+}
+
+// Crc32cUint32Bytes calculates a CRC32C checksum of the given byte slice,
+// returning the checksum as uint32; it never allocates.
+func Crc32cUint32Bytes(b []byte) uint32 {
+	return crc32.Update(0, castagnoliTable, b)
 }
 
 // Crc32ChecksumBytes calculates a CRC32 checksum of the given string,
 // returning the bytes of the checksum.
 func Crc32ChecksumBytes(s string) []byte {
-	crc := GenerateCrc32Uint32(s)
 	buf := make([]byte, 4)
-	binary.BigEndian.PutUint32(buf, crc)
+	binary.BigEndian.PutUint32(buf, GenerateCrc32Uint32(s))
 
 	return buf
 }
@@ -136,27 +174,27 @@ func GenerateSecureRandomBytes(length int) []byte {
 }
 
 // SelectInsecureRandomInt selects a random value from the given arguments
-// using insecure randomness. Returns 0 if no arguments are given.
+// using insecure randomness, from a source shared by every call (and seeded
+// once), so that consecutive selections aren't correlated. Returns 0 if no
+// arguments are given; see Rand for reproducible selection.
 func SelectInsecureRandomInt(vals ...int) int {
 	length := len(vals)
 	if length < 1 {
 		return 0
 	}
 
-	r := irand.New(irand.NewSource(time.Now().UnixNano())) //#nosec:G404
-
-	return vals[r.Intn(length)] //#nosec:G404
+	return vals[irand.Intn(length)] //#nosec:G404
 }
 
 // SelectInsecureRandomStr selects a random value from the given arguments
-// using insecure randomness. Returns empty string if no arguments are given.
+// using insecure randomness, from a source shared by every call (and seeded
+// once), so that consecutive selections aren't correlated. Returns empty
+// string if no arguments are given; see Rand for reproducible selection.
 func SelectInsecureRandomStr(vals ...string) string {
 	length := len(vals)
 	if length < 1 {
 		return ""
 	}
 
-	r := irand.New(irand.NewSource(time.Now().UnixNano())) //#nosec:G404
-
-	return vals[r.Intn(length)] //#nosec:G404
+	return vals[irand.Intn(length)] //#nosec:G404
 }
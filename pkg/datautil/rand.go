@@ -0,0 +1,125 @@
+// Package datautil provides utilities for randomness, encode/decode, etc.
+// This section of the datautil package holds injectable sources of
+// randomness, so that generation can be made reproducible.
+package datautil
+
+import (
+	srand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"math"
+	irand "math/rand"
+	"sync"
+)
+
+// uint64Size "enum" so we're not using magic numbers; 64 bits = 8 * 1 byte.
+const uint64Size = 8
+
+// Rand is a source of randomness for generation, backed by a byte stream;
+// every value it produces is read from the stream, so a deterministic stream
+// always produces the same sequence of values. It is safe for concurrent
+// use, though concurrent callers make the sequence nondeterministic.
+type Rand struct {
+	mu     sync.Mutex
+	stream io.Reader
+}
+
+// NewRand returns a Rand that reads from the given stream.
+func NewRand(stream io.Reader) *Rand {
+	return &Rand{stream: stream} //nolint:exhaustruct
+}
+
+// NewSecureRand returns a Rand that reads from crypto/rand; see
+// GenerateSecureRandomBytes for how read errors are handled.
+func NewSecureRand() *Rand {
+	return NewRand(srand.Reader)
+}
+
+// NewSeededRand returns a Rand that reads from a deterministic stream seeded
+// w/ the given seed; the same seed always produces the same sequence. This
+// is not cryptographically secure, and is meant for reproducible
+// experiments and test fixtures.
+func NewSeededRand(seed int64) *Rand {
+	return NewRand(irand.New(irand.NewSource(seed))) //#nosec:G404
+}
+
+// DeriveSeed returns a seed for the given stream, derived from the given
+// seed, for seeding many independent deterministic streams from a single
+// seed; streams of the same seed get unrelated seeds. The derivation is the
+// splitmix64 finalizer, which spreads adjacent inputs across all 64 bits.
+func DeriveSeed(seed int64, stream uint64) int64 {
+	z := uint64(seed) + (stream+1)*0x9e3779b97f4a7c15 //nolint:gomnd
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9          //nolint:gomnd
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb          //nolint:gomnd
+
+	return int64(z ^ (z >> 31)) //nolint:gomnd
+}
+
+// Read fills the given buffer from the stream; a Rand is also an io.Reader.
+func (r *Rand) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return io.ReadFull(r.stream, p) //nolint:wrapcheck
+}
+
+// Bytes returns a byte slice of the given length filled from the stream; if
+// the stream fails, the rest of the buffer is filled w/ insecurely generated
+// random data, as GenerateSecureRandomBytes does.
+func (r *Rand) Bytes(length int) []byte {
+	buf := make([]byte, length)
+	n, err := r.Read(buf)
+	if err != nil {
+		copy(buf[n:], generateInsecureRandomBytes(length-n))
+	}
+
+	return buf
+}
+
+// Uint64 returns a uniformly distributed 64 bit value.
+func (r *Rand) Uint64() uint64 {
+	return binary.BigEndian.Uint64(r.Bytes(uint64Size))
+}
+
+// Float64 returns a uniformly distributed value in [0, 1).
+func (r *Rand) Float64() float64 {
+	// the top 53 bits fill a float64's mantissa exactly.
+	return float64(r.Uint64()>>11) / (1 << 53) //nolint:gomnd
+}
+
+// Intn returns a uniformly distributed value in [0, n), or 0 if n < 1;
+// values are drawn from the stream w/o modulo bias.
+func (r *Rand) Intn(n int) int {
+	if n < 1 {
+		return 0
+	}
+
+	// reject draws from the partial range at the top of uint64, which would
+	// otherwise bias the modulo toward low values.
+	limit := math.MaxUint64 - math.MaxUint64%uint64(n)
+	for {
+		if v := r.Uint64(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// SelectInt selects a random value from the given arguments. Returns 0 if no
+// arguments are given.
+func (r *Rand) SelectInt(vals ...int) int {
+	if len(vals) < 1 {
+		return 0
+	}
+
+	return vals[r.Intn(len(vals))]
+}
+
+// SelectStr selects a random value from the given arguments. Returns empty
+// string if no arguments are given.
+func (r *Rand) SelectStr(vals ...string) string {
+	if len(vals) < 1 {
+		return ""
+	}
+
+	return vals[r.Intn(len(vals))]
+}
@@ -0,0 +1,246 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds the streaming extractor, which
+// finds tokens in text read from an io.Reader, w/o holding all of it at once.
+package ghtoken
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+)
+
+const (
+	// DefaultChunkSize is the number of bytes an Extractor reads at once,
+	// unless configured otherwise.
+	DefaultChunkSize = 32 << 10
+	// DefaultContext is the number of bytes of context an Extractor keeps on
+	// either side of a token, unless configured otherwise.
+	DefaultContext = 32
+)
+
+// Extracted is a token candidate extracted from a stream; see FindAll for
+// what makes a candidate.
+type Extracted struct {
+	Token *GhToken `json:"token"`
+	// Offset is the 0-based byte offset of the token in the stream.
+	Offset int64 `json:"offset"`
+	// Line and Column are 1-based; columns count bytes.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Before and After hold the text surrounding the token, on the same line,
+	// up to the configured number of bytes on either side.
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Extractor extracts every token candidate from a stream, in the order they
+// appear, reading it in chunks; tokens that straddle chunks are found just the
+// same as if the stream were read at once. Like a bufio.Scanner, an
+// Extractor is advanced w/ Next, and isn't safe for concurrent use.
+type Extractor struct {
+	r       io.Reader
+	chunk   int
+	context int
+	// buf holds the unread window of the stream, which starts at base; every
+	// candidate starting before from has been extracted, and every newline
+	// before counted has been counted.
+	buf       []byte
+	base      int64
+	from      int
+	counted   int
+	line      int
+	lineStart int64
+	// behind and ahead are the number of bytes kept before from, and past the
+	// last candidate extracted from a window, so the context and boundaries
+	// of a candidate are always in the window.
+	behind int
+	ahead  int
+	// finder and view find, and parse, the candidates of each window w/o
+	// allocating, so candidates dropped by validOnly cost nothing.
+	finder    *Finder
+	view      View
+	validOnly bool
+	found     []Extracted
+	cur       Extracted
+	eof       bool
+	err       error
+}
+
+// ExtractorOption configures an Extractor.
+type ExtractorOption func(*Extractor)
+
+// WithChunkSize sets the number of bytes an Extractor reads at once; sizes
+// less than 1 are ignored.
+func WithChunkSize(n int) ExtractorOption {
+	return func(e *Extractor) {
+		if n > 0 {
+			e.chunk = n
+		}
+	}
+}
+
+// WithContext sets the number of bytes of context an Extractor keeps on
+// either side of a token; sizes less than 0 are ignored.
+func WithContext(n int) ExtractorOption {
+	return func(e *Extractor) {
+		if n >= 0 {
+			e.context = n
+		}
+	}
+}
+
+// WithValidOnly makes an Extractor skip token candidates that don't have a
+// valid schema (see View.Valid); skipped candidates are found and validated
+// w/o allocating, so this is much faster than filtering on
+// Token.SchemaValid when most candidates are invalid.
+func WithValidOnly() ExtractorOption {
+	return func(e *Extractor) {
+		e.validOnly = true
+	}
+}
+
+// NewExtractor returns an Extractor that reads from the given reader; the
+// registered schemas are captured when it's created, so schemas registered
+// later may not be extracted in full.
+func NewExtractor(r io.Reader, opts ...ExtractorOption) *Extractor {
+	e := &Extractor{
+		r:         r,
+		chunk:     DefaultChunkSize,
+		context:   DefaultContext,
+		buf:       nil,
+		base:      0,
+		from:      0,
+		counted:   0,
+		line:      1,
+		lineStart: 0,
+		behind:    0,
+		ahead:     0,
+		finder:    NewFinder(),
+		view:      View{}, //nolint:exhaustruct
+		validOnly: false,
+		found:     nil,
+		cur:       Extracted{}, //nolint:exhaustruct
+		eof:       false,
+		err:       nil,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	longest := 0
+	for _, s := range e.finder.schemas {
+		longest = max(longest, len(s.Prefix)+len(Sep)+s.PayloadLength())
+	}
+	e.behind = max(1, e.context)
+	e.ahead = longest + 1 + e.context
+
+	return e
+}
+
+// Next advances the extractor to the next token candidate, which is then
+// available through Extracted; it returns false once the stream is drained,
+// or reading it failed, in which case Err returns the error.
+func (e *Extractor) Next() bool {
+	for len(e.found) < 1 {
+		if e.eof || e.err != nil {
+			return false
+		}
+		e.fill()
+	}
+	e.cur, e.found = e.found[0], e.found[1:]
+
+	return true
+}
+
+// Extracted returns the token candidate the extractor was advanced to.
+func (e *Extractor) Extracted() Extracted {
+	return e.cur
+}
+
+// Err returns the first error reading the stream, other than io.EOF.
+func (e *Extractor) Err() error {
+	return e.err
+}
+
+// Read the next chunk of the stream into the window, and extract the
+// candidates whose boundaries and context are known.
+func (e *Extractor) fill() {
+	if drop := e.from - e.behind; drop > 0 {
+		e.buf = append(e.buf[:0], e.buf[drop:]...)
+		e.base += int64(drop)
+		e.from -= drop
+		e.counted -= drop
+	}
+
+	n := len(e.buf)
+	e.buf = slices.Grow(e.buf, e.chunk)[:n+e.chunk]
+	read, err := e.r.Read(e.buf[n:])
+	e.buf = e.buf[:n+read]
+	switch {
+	case errors.Is(err, io.EOF):
+		e.eof = true
+	case err != nil:
+		e.err = err
+
+		return
+	}
+
+	to := len(e.buf) - e.ahead
+	if e.eof {
+		to = len(e.buf)
+	}
+	if to <= e.from {
+		return
+	}
+
+	e.finder.Reset(e.buf, e.from, to)
+	for start, end, ok := e.finder.Next(&e.view); ok; start, end, ok = e.finder.Next(&e.view) {
+		if e.validOnly && !e.view.Valid() {
+			continue
+		}
+		e.found = append(e.found, e.extracted(start, end))
+	}
+	e.from = to
+	e.countLines(to)
+}
+
+// Return the candidate found in the window between the given offsets, w/
+// it's position in the stream and context.
+func (e *Extractor) extracted(start, end int) Extracted {
+	e.countLines(start)
+
+	before := max(0, start-e.context)
+	if i := bytes.LastIndexByte(e.buf[before:start], '\n'); i >= 0 {
+		before += i + 1
+	}
+	after := min(len(e.buf), end+e.context)
+	if i := bytes.IndexByte(e.buf[end:after], '\n'); i >= 0 {
+		after = end + i
+	}
+
+	return Extracted{
+		Token:  ParseGhToken(string(e.buf[start:end])),
+		Offset: e.base + int64(start),
+		Line:   e.line,
+		Column: int(e.base + int64(start) - e.lineStart + 1),
+		Before: string(e.buf[before:start]),
+		After:  string(bytes.TrimSuffix(e.buf[end:after], []byte("\r"))),
+	}
+}
+
+// Count the newlines in the window up to the given index.
+func (e *Extractor) countLines(to int) {
+	for e.counted < to {
+		i := bytes.IndexByte(e.buf[e.counted:to], '\n')
+		if i < 0 {
+			e.counted = to
+
+			break
+		}
+		e.counted += i + 1
+		e.line++
+		e.lineStart = e.base + int64(e.counted)
+	}
+}
@@ -0,0 +1,102 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds the implementation for finding
+// and masking tokens in arbitrary text.
+package ghtoken
+
+import (
+	"strings"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// MaskVisible is the number of trailing characters Mask leaves visible; they
+// fall within the checksum of any registered schema, so they reveal nothing
+// about the token's input.
+const MaskVisible = 4
+
+// Found is a token found in text, along w/ the byte offsets of the token
+// within the text (i.e. text[Start:End] is the token).
+type Found struct {
+	Token *GhToken `json:"token"`
+	Start int      `json:"start"`
+	End   int      `json:"end"`
+}
+
+// FindAll returns every token candidate in the given text, in the order they
+// appear; a candidate is a registered prefix followed by the separator and a
+// payload of the length and alphabet expected by the prefix's schema, that
+// isn't part of a longer word on either side. Candidates are parsed and
+// validated, so callers interested only in tokens w/ a valid checksum should
+// filter on Token.SchemaValid.
+func FindAll(text string) []Found {
+	return find(text, 0, len(text))
+}
+
+// Find every token candidate in the given text that starts at or after from
+// and before to; see Finder.Reset.
+func find(text string, from, to int) []Found {
+	found := make([]Found, 0)
+	f := NewFinder()
+	f.Reset([]byte(text), from, to)
+
+	var v View
+	for start, end, ok := f.Next(&v); ok; start, end, ok = f.Next(&v) {
+		found = append(found, Found{Token: ParseGhToken(text[start:end]), Start: start, End: end})
+	}
+
+	return found
+}
+
+// FindValid returns every token in the given text that has a valid schema;
+// see FindAll.
+func FindValid(text string) []Found {
+	valid := make([]Found, 0)
+	for _, f := range FindAll(text) {
+		if f.Token.SchemaValid {
+			valid = append(valid, f)
+		}
+	}
+
+	return valid
+}
+
+// Mask returns the given token w/ every character of it's payload replaced by
+// '*', other than the last MaskVisible characters; the prefix and separators
+// are left intact, so the type of token is still recognizable. If the token
+// has no separator, every character but the last MaskVisible is masked.
+func Mask(tok string) string {
+	tok = strings.TrimSpace(tok)
+	s, pl, _ := schema.Match(tok)
+	lead := len(tok) - len(pl)
+	if !strings.Contains(tok, Sep) {
+		lead = 0
+	}
+
+	masked := []byte(tok)
+	for i := lead; i < len(masked)-MaskVisible; i++ {
+		if len(s.Segments) > 1 && string(masked[i]) == Sep {
+			continue
+		}
+		masked[i] = '*'
+	}
+
+	return string(masked)
+}
+
+// Mask returns the token masked for display; see Mask.
+func (token GhToken) Mask() string {
+	return Mask(token.FullToken)
+}
+
+// Tests if the given byte may appear in the payload of a token of the given
+// schema.
+func isPayloadByte(s *schema.Schema, c byte) bool {
+	return s.InAlphabet(c) || (len(s.Segments) > 1 && string(c) == Sep)
+}
+
+// Tests if the given byte would make a token of the given schema part of a
+// longer word, when adjacent to the token.
+func isWordByte(s *schema.Schema, c byte) bool {
+	return isPayloadByte(s, c) || string(c) == Sep ||
+		('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,249 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds the implementation for generating
+// GitHub-like tokens.
+package ghtoken
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// Generator generates GitHub-like tokens, drawing every random choice (the
+// random prefix, the number of random bytes, and the bytes themselves) from a
+// single source of randomness; a Generator w/ a deterministic source always
+// generates the same sequence of tokens. A Generator is safe for concurrent
+// use, though concurrent callers make the sequence nondeterministic.
+type Generator struct {
+	rand     *datautil.Rand
+	prefixes *weighted[string]
+	segments map[int]segmentCalibration
+}
+
+// segmentCalibration is the form of a SegmentProfile used while generating;
+// values holds the range of values of each byte length.
+type segmentCalibration struct {
+	byteLengths weighted[int]
+	pad         bool
+	values      map[int]valueRange
+}
+
+// valueRange is a range of values, from lo, inclusive, to lo+span, exclusive.
+type valueRange struct {
+	lo   *big.Int
+	span *big.Int
+}
+
+// GeneratorOption configures a Generator.
+type GeneratorOption func(*Generator)
+
+// WithProfile calibrates the generator w/ the given profile, which should
+// have been checked (see Profile.Check); a nil profile is a no-op.
+func WithProfile(p *Profile) GeneratorOption {
+	return func(g *Generator) {
+		if p == nil {
+			return
+		}
+
+		if len(p.PrefixWeights) > 0 {
+			prefixes := newWeighted(p.PrefixWeights)
+			g.prefixes = &prefixes
+		}
+
+		for length, seg := range p.Segments {
+			values := make(map[int]valueRange, len(seg.ByteLengthWeights))
+			for n := range seg.ByteLengthWeights {
+				values[n] = calibratedValues(n, length, seg.Pad)
+			}
+			g.segments[length] = segmentCalibration{
+				byteLengths: newWeighted(seg.ByteLengthWeights),
+				pad:         seg.Pad,
+				values:      values,
+			}
+		}
+	}
+}
+
+// NewGenerator returns a Generator that draws from the given source of
+// randomness.
+func NewGenerator(r *datautil.Rand, opts ...GeneratorOption) *Generator {
+	g := &Generator{
+		rand:     r,
+		prefixes: nil,
+		segments: make(map[int]segmentCalibration),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// NewSeededGenerator returns a Generator that draws from a deterministic
+// stream seeded w/ the given seed; see datautil.NewSeededRand.
+func NewSeededGenerator(seed int64, opts ...GeneratorOption) *Generator {
+	return NewGenerator(datautil.NewSeededRand(seed), opts...)
+}
+
+// Fork returns a Generator w/ the same calibration as g that draws from the
+// given source of randomness; the calibration is shared rather than rebuilt,
+// so forking is cheap enough to give every batch of tokens a generator of
+// it's own. A fork of g generates the same tokens as a Generator built w/ the
+// same options and source.
+func (g *Generator) Fork(r *datautil.Rand) *Generator {
+	return &Generator{
+		rand:     r,
+		prefixes: g.prefixes,
+		segments: g.segments,
+	}
+}
+
+// defaultGenerator is the generator used by the package level functions.
+var defaultGenerator = NewGenerator(datautil.NewSecureRand())
+
+// Generate generates a GitHub-like token w/ the given prefix, using secure
+// randomness; the payload follows the registered schema of the given prefix,
+// or the unknown schema if the prefix isn't registered. This does not check
+// the validity of the provided token prefix.
+func Generate(prefix string) *GhToken {
+	return defaultGenerator.Generate(prefix)
+}
+
+// GenerateRandomPrefix generates a GitHub-like token w/ a randomly selected
+// valid prefix; see Generate.
+func GenerateRandomPrefix() *GhToken {
+	return defaultGenerator.GenerateRandomPrefix()
+}
+
+// Generate generates a GitHub-like token w/ the given prefix; see the
+// package level Generate.
+func (g *Generator) Generate(prefix string) *GhToken {
+	s, _ := GetSchema(prefix)
+
+	segments := make([]string, 0, len(s.Segments))
+	for i, length := range s.Segments {
+		if i == len(s.Segments)-1 {
+			length -= s.ChecksumLength
+		}
+		segments = append(segments, g.genEncodedRandom(s, length))
+	}
+
+	input := strings.Join(segments, Sep)
+	crc := s.EncodeChecksum(input)
+
+	payload := fmt.Sprintf("%s%s", input, crc)
+	fullToken := fmt.Sprintf("%s%s%s", prefix, Sep, payload)
+
+	return ParseGhToken(fullToken)
+}
+
+// GenerateRandomPrefix generates a GitHub-like token w/ a randomly selected
+// valid prefix, weighted by the generator's profile if it has one; see
+// Generate.
+func (g *Generator) GenerateRandomPrefix() *GhToken {
+	if g.prefixes != nil {
+		return g.Generate(g.prefixes.draw(g.rand.Float64()))
+	}
+
+	return g.Generate(g.rand.SelectStr(GetValidPrefixes()...))
+}
+
+// Generate a string of the given length from random bytes, base62 encoded w/
+// the given schema's alphabet; the string is 0-padded when it underflows the
+// desired length (unsure if we should 0-pad, but doing it anyways), and
+// regenerated when it overflows. Segments of lengths calibrated by the
+// generator's profile are generated w/ genCalibrated instead.
+func (g *Generator) genEncodedRandom(s schema.Schema, length int) string {
+	if c, found := g.segments[length]; found {
+		return g.genCalibrated(s, length, c)
+	}
+
+	for {
+		b := g.rand.Bytes(g.rand.SelectInt(randomByteLengths(length)...))
+		if enc, err := s.EncodeWidth(b, length); err == nil {
+			return enc
+		}
+	}
+}
+
+// Generate a string of the given length from a random value w/ a number of
+// significant bytes drawn from the calibration's weights; the value is
+// uniformly distributed among those w/ that many significant bytes that fit
+// in the length (and, w/o padding, that fill it), so a corpus' implied byte
+// lengths are reproduced exactly.
+func (g *Generator) genCalibrated(s schema.Schema, length int, c segmentCalibration) string {
+	// the byte length is drawn once; redrawing it when the value doesn't fit
+	// would skew the mix away from lengths that often don't fit.
+	values := c.values[c.byteLengths.draw(g.rand.Float64())]
+	for {
+		v := g.drawBelow(values.span)
+		if enc, err := s.EncodeWidth(v.Add(v, values.lo).Bytes(), length); err == nil {
+			return enc
+		}
+	}
+}
+
+// Return the range of values w/ the given number of significant bytes that
+// fit in a string of the given length, and, w/o padding, fill it; profiles
+// are checked, so the range is never empty.
+func calibratedValues(n, length int, pad bool) valueRange {
+	pow := func(base, exp int) *big.Int {
+		return new(big.Int).Exp(big.NewInt(int64(base)), big.NewInt(int64(max(exp, 0))), nil)
+	}
+
+	// zero is the only value w/o a significant byte.
+	lo, hi := pow(256, n-1), pow(256, n) //nolint:gomnd
+	if n < 1 {
+		lo = big.NewInt(0)
+	}
+	if fit := pow(schema.AlphabetSize, length); hi.Cmp(fit) > 0 {
+		hi = fit
+	}
+	if fill := pow(schema.AlphabetSize, length-1); !pad && lo.Cmp(fill) < 0 {
+		lo = fill
+	}
+
+	return valueRange{lo: lo, span: new(big.Int).Sub(hi, lo)}
+}
+
+// Draw a value uniformly from 0, inclusive, to the given bound, exclusive;
+// the top byte of each draw is masked to the bit length of the bound, so at
+// most half of the draws are rejected, however small the bound is.
+func (g *Generator) drawBelow(bound *big.Int) *big.Int {
+	bits := bound.BitLen()
+	v := new(big.Int)
+	for {
+		b := g.rand.Bytes((bits + 7) / 8) //nolint:gomnd
+		if extra := bits % 8; extra > 0 {
+			b[0] &= byte(1<<extra - 1)
+		}
+
+		if v.SetBytes(b).Cmp(bound) < 0 {
+			return v
+		}
+	}
+}
+
+// Returns the number of random bytes that may be encoded to produce a base62
+// string of the given length; the first is the largest number of bytes that
+// can't overflow the length, the second is one more than that.
+//
+// For 30 character token input, 22 bytes often encodes to 30 character
+// strings, but sometimes underflows to 29 character strings; 23 bytes often
+// encodes to 30 character strings, but sometimes overflows to 31 character
+// strings.
+// From a manual analysis compared against a small set of real GitHub tokens,
+// it appears that generating 23 bytes most closely mimics real token data;
+// Larger scale automated analysis would better serve to prove this hypothesis;
+// the analyze command compares the implied byte lengths, padding, and symbol
+// frequencies of generated tokens against a corpus of real tokens.
+func randomByteLengths(length int) []int {
+	n := int(float64(length) * math.Log2(schema.AlphabetSize) / 8)
+
+	return []int{n, n + 1}
+}
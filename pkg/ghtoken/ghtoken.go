@@ -0,0 +1,303 @@
+// Package ghtoken provides features for working with GitHub tokens; it also
+// works w/ tokens of any schema in the schema package's default registry,
+// since they all follow the same design.
+//
+// The public surface of this package is: parse (ParseGhToken), validate
+// (ValidateToken, GhToken.Validate), generate (Generate), find-in-text
+// (FindAll, FindValid), and mask (Mask).
+//
+// Compatibility: the packages under pkg/ follow semantic versioning of the
+// token-forge module; within a major version, exported identifiers are not
+// removed or changed incompatibly, the json field names of GhToken are not
+// renamed, and the sentinel errors wrapped by a ValidationError keep their
+// meaning. New prefixes may be registered and new validation reasons may be
+// added in minor versions, so callers should not assume the set of either is
+// closed. Anything under internal/ carries no such guarantee.
+package ghtoken
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// Notes on GitHub token types; each type is described by a schema in the
+// schema package's built-in schemas.
+//
+// Valid PATs (ghp) can be tested by querying user info.
+//
+// Valid oauth tokens (gho) can be tested by querying user info
+// (https://docs.github.com/en/developers/apps/building-oauth-apps/authorizing-oauth-apps#3-use-the-access-token-to-access-the-api)
+// or by searching available installations and repos
+// (https://docs.github.com/en/developers/apps/building-github-apps/identifying-and-authorizing-users-for-github-apps#check-which-installations-resources-a-user-can-access).
+//
+// Valid user-to-server tokens (ghu) can be tested by querying user info or
+// any of the following endpoints (https://docs.github.com/en/developers/apps/building-github-apps/identifying-and-authorizing-users-for-github-apps#user-to-server-requests);
+// apps can be configured to generate expiring user-to-server tokens, and these tokens expire
+// after 8 hours when configured as such (https://docs.github.com/en/developers/apps/building-github-apps/refreshing-user-to-server-access-tokens).
+//
+// Server-to-server / GitHub App tokens (ghs) are nominally generated in the following way
+// (https://docs.github.com/en/rest/reference/apps#create-an-installation-access-token-for-an-app);
+// due to their short validity period (https://docs.github.com/en/developers/apps/building-github-apps/authenticating-with-github-apps#authenticating-as-an-installation),
+// these are probably not that interesting; regardless, the following API
+// endpoints can nominally querying w/ a server-to-server token (https://docs.github.com/en/rest/reference/apps).
+//
+// Refresh tokens (ghr) require an app's client id and client secret to be submitted w/ the
+// refresh token in order to obtain a new user-to-server token (ghu), and they also don't
+// quite follow the same format as the other tokens (i.e. a 76 character payload); it is
+// assumed that the checksum still occupies the last 6 characters of the payload
+// (https://docs.github.com/en/developers/apps/building-github-apps/refreshing-user-to-server-access-tokens#renewing-a-user-token-with-a-refresh-token).
+// Since that is an assumption, the schema's checksum is marked as unverified:
+// refresh tokens are generated w/ it, but only their structure is validated.
+//
+// Fine-grained personal access tokens (github_pat) follow a different layout; the
+// prefix itself contains the separator, and the payload is made up of two
+// segments, separated by the same separator (a 22 character identifier
+// segment and a 59 character secret segment). GitHub hasn't documented how
+// the checksum of a fine-grained token is calculated; here it is assumed that
+// the same design applies, with the last 6 characters of the secret segment
+// being the checksum of everything in the payload that precedes it
+// (https://github.blog/2022-10-18-introducing-fine-grained-personal-access-tokens-for-github/).
+// As w/ refresh tokens, the schema's checksum is marked as unverified, so
+// leaked fine-grained tokens aren't dropped if the assumption is wrong.
+//
+// Summary per github documentation:
+// github_pat meets 22+59 character format; user-configurable expiration;
+// ghp meets 36 character format; user-configurable expiration;
+// gho meets 36 character format; no apparent expiration (unless not used within the last year);
+// ghu meets 36 character format; 8 hour expiration (or indefinite, depending on configuration);
+// ghs meets 36 character format; 1 hour expiration;
+// ghr meets 76 character format; 6 month expiration, independent of the ghu it was issued w/
+// (https://docs.github.com/en/developers/apps/building-github-apps/refreshing-user-to-server-access-tokens#renewing-a-user-token-with-a-refresh-token).
+
+const (
+	// Base62Alphabet "enum" to choose a specific base62 alphabet while
+	// encoding/decoding; more often than not, due to the alphabet that
+	// Golang's big.Int package uses, an inverted alphabet should be chosen
+	// when working with tokens produced by or intended to be consumed by
+	// GitHub.
+	Base62Alphabet = true
+	// PrefixLength "enum" so we're not using magic numbers; it is the length
+	// of the classic GitHub prefixes (e.g. "ghp").
+	//
+	// Deprecated: prefixes vary in length (e.g. "github_pat", or those of
+	// custom schemas); use the length of a schema's Prefix instead.
+	PrefixLength = 3
+	// ChecksumLength "enum" so we're not using magic numbers; after the
+	// checksum is calculated, it occupies the last 6 characters in the final
+	// GitHub token.
+	ChecksumLength = schema.GitHubChecksumLength
+	// PayloadLength "enum" so we're not using magic numbers; once the
+	// prefix and '_' are stripped from a GitHub token, the resulting payload
+	// is 36 characters long.
+	PayloadLength = schema.GitHubPayloadLength
+	// InputLength "enum" so we're not using magic numbers; token input is
+	// the token payload without the appended checksum.
+	InputLength = PayloadLength - ChecksumLength
+	// RefreshPayloadLength "enum" so we're not using magic numbers; once the
+	// prefix and '_' are stripped from a GitHub refresh token, the resulting
+	// payload is 76 characters long.
+	RefreshPayloadLength = schema.GitHubRefreshPayloadLength
+	// Sep is the character that separates a GitHub token's prefix from
+	// it's payload.
+	Sep = schema.Sep
+	// FineGrainedPrefix is the prefix of fine-grained personal access tokens;
+	// unlike other prefixes, it contains the separator.
+	FineGrainedPrefix = schema.GitHubFineGrainedPrefix
+	// FineGrainedIDLength "enum" so we're not using magic numbers; the first
+	// segment of a fine-grained token's payload is 22 characters long.
+	FineGrainedIDLength = schema.GitHubFineGrainedIDLength
+	// FineGrainedSecretLength "enum" so we're not using magic numbers; the
+	// second segment of a fine-grained token's payload is 59 characters long,
+	// including the checksum.
+	FineGrainedSecretLength = schema.GitHubFineGrainedSecretLength
+	// FineGrainedPayloadLength "enum" so we're not using magic numbers; once
+	// the prefix and '_' are stripped from a fine-grained token, the resulting
+	// payload is both segments joined by the separator.
+	FineGrainedPayloadLength = FineGrainedIDLength + len(Sep) + FineGrainedSecretLength
+	// FineGrainedInputLength "enum" so we're not using magic numbers;
+	// fine-grained token input is the token payload without the appended
+	// checksum.
+	FineGrainedInputLength = FineGrainedPayloadLength - ChecksumLength
+)
+
+// GetValidPrefixes returns a string slice of the valid token prefixes, i.e.
+// the prefixes of every schema in the default registry.
+func GetValidPrefixes() []string {
+	return schema.Default().Prefixes()
+}
+
+// GetSchema returns the schema of tokens w/ the given prefix; if the prefix is
+// not valid, the unknown schema for the prefix and false are returned.
+func GetSchema(prefix string) (schema.Schema, bool) {
+	s, ok := schema.Lookup(prefix)
+	if !ok {
+		return schema.Unknown(prefix), false
+	}
+
+	return s, true
+}
+
+// GhToken holds full token and pre-carved components of a GitHub token (or a
+// token of any other registered schema); the EncodedID and EncodedSecret
+// members are only populated for tokens whose schema has two payload segments
+// (i.e. fine-grained tokens), where they hold the two segments.
+type GhToken struct {
+	FullToken      string   `json:"fullToken"`
+	Schema         string   `json:"schema"`
+	Prefix         string   `json:"prefix"`
+	EncodedPayload string   `json:"encodedPayload"`
+	EncodedInput   string   `json:"encodedInput"`
+	EncodedCrc     string   `json:"encodedCrc"`
+	EncodedID      string   `json:"encodedId,omitempty"`
+	EncodedSecret  string   `json:"encodedSecret,omitempty"`
+	SchemaChecked  bool     `json:"schemaChecked"`
+	SchemaValid    bool     `json:"schemaValid"`
+	SchemaErrors   []string `json:"schemaErrors,omitempty"`
+}
+
+// ParseGhToken builds a new ghToken struct from a GitHub token string; if
+// token is malformed, a ghToken struct is returned that only has FullToken
+// populated (based on the original input).
+func ParseGhToken(tok string) *GhToken {
+	//nolint:exhaustruct
+	token := &GhToken{
+		FullToken: strings.TrimSpace(tok),
+	}
+
+	token.fillToken()
+	token.ValidateSchema()
+
+	return token
+}
+
+// fillToken populates the subcomponent struct members based on the current
+// contents of FullToken; if the current FullToken member doesn't contain a
+// valid separator ('_'), then this function early returns without attempting
+// to populate the rest of the struct members; likewise, if the payload is too
+// short to hold a checksum, only the prefix and payload are populated; this
+// function does not validate correctness of the token, but instead resets the
+// flags denoting any attempted validation.
+func (token *GhToken) fillToken() {
+	token.SchemaValid = false
+	token.SchemaChecked = false
+	token.FullToken = strings.TrimSpace(token.FullToken)
+
+	if !strings.Contains(token.FullToken, Sep) {
+		return
+	}
+
+	s, pl, _ := schema.Match(token.FullToken)
+	token.Schema = s.Name
+	token.Prefix = s.Prefix
+	token.EncodedPayload = pl
+
+	if len(s.Segments) > 1 {
+		id, secret, found := strings.Cut(pl, Sep)
+		if !found {
+			return
+		}
+		token.EncodedID = id
+		token.EncodedSecret = secret
+	}
+
+	if len(pl) < s.ChecksumLength {
+		return
+	}
+
+	token.EncodedInput = pl[:len(pl)-s.ChecksumLength]
+	token.EncodedCrc = pl[len(pl)-s.ChecksumLength:]
+}
+
+// IsFineGrained returns whether or not the token is a fine-grained personal
+// access token.
+func (token GhToken) IsFineGrained() bool {
+	return token.Prefix == FineGrainedPrefix
+}
+
+// HasValidSegments returns whether or not the token's payload segments have
+// the lengths expected by the schema of the token's prefix; tokens w/ an
+// invalid prefix never have valid segments.
+func (token GhToken) HasValidSegments() bool {
+	s, ok := GetSchema(token.Prefix)
+	if !ok {
+		return false
+	}
+
+	if len(s.Segments) > 1 {
+		return len(token.EncodedID) == s.Segments[0] && len(token.EncodedSecret) == s.Segments[1]
+	}
+
+	return len(token.EncodedPayload) == s.PayloadLength()
+}
+
+// IsValidPrefix returns if the given string is a valid ghToken prefix.
+func IsValidPrefix(prefix string) bool {
+	_, valid := schema.Lookup(prefix)
+
+	return valid
+}
+
+// HasValidPrefix returns whether or not the token's prefix is valid.
+func (token GhToken) HasValidPrefix() bool {
+	return IsValidPrefix(token.Prefix)
+}
+
+// HasValidChecksum a GitHub token's checksum, using the checksum algorithm
+// and alphabet of the token's schema, even if the schema's checksum is
+// unverified; it never allocates w/ the built-in checksum algorithms.
+func (token GhToken) HasValidChecksum() bool {
+	s, _ := GetSchema(token.Prefix)
+	origCrc, ok := s.DecodeChecksum(token.EncodedCrc)
+	if !ok {
+		return false
+	}
+
+	return s.Checksum.Sum32(token.EncodedInput) == origCrc
+}
+
+// ValidateSchema checks the token's schema (see Validate); once a token's
+// schema is validated, flags are set in the GhToken to signify that it has
+// been checked and whether or not it appears to have a valid schema, and the
+// reasons it is invalid (if any) are recorded.
+func (token *GhToken) ValidateSchema() {
+	err := token.Validate()
+	token.SchemaChecked = true
+	token.SchemaValid = err == nil
+	token.SchemaErrors = nil
+
+	var joined interface{ Unwrap() []error }
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, &joined):
+		for _, e := range joined.Unwrap() {
+			token.SchemaErrors = append(token.SchemaErrors, e.Error())
+		}
+	default:
+		token.SchemaErrors = append(token.SchemaErrors, err.Error())
+	}
+}
+
+// PrintTokenAttributes prints the ghToken struct, and simply logs an error if
+// it fails to pretty print.
+func (token GhToken) PrintTokenAttributes() {
+	if err := token.prettyPrintToken(); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// Print json of GHToken attributes and test validity of token.
+func (token GhToken) prettyPrintToken() error {
+	token.ValidateSchema()
+	if err := fileutil.WriteJSON(os.Stdout, token); err != nil {
+		return fmt.Errorf("failed printing token '%s': %w", token.FullToken, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds calibration profiles, which tune
+// generation to resemble an observed corpus of tokens.
+package ghtoken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// Profile calibrates a Generator to resemble an observed corpus of tokens
+// (see the analyze command); it replaces the generator's uniform choice of
+// prefix, and it's choice between two random byte lengths, w/ weights
+// observed in the corpus.
+type Profile struct {
+	// Source describes the corpus the profile was built from.
+	Source string `json:"source,omitempty"`
+	// PrefixWeights weights the choice of prefix when generating tokens w/ a
+	// random prefix; only the weighted prefixes are chosen. If empty,
+	// registered prefixes are chosen uniformly.
+	PrefixWeights map[string]float64 `json:"prefixWeights,omitempty"`
+	// Segments calibrates the generation of random segments, keyed by the
+	// length of the segment (less the checksum, for the final segment);
+	// segments of other lengths are generated as if uncalibrated.
+	Segments map[int]SegmentProfile `json:"segments,omitempty"`
+}
+
+// SegmentProfile calibrates the generation of random segments of a length.
+type SegmentProfile struct {
+	// ByteLengthWeights weights the number of significant bytes (i.e. bytes
+	// after any leading zero bytes) of the value encoded into the segment.
+	ByteLengthWeights map[int]float64 `json:"byteLengthWeights"`
+	// Pad is whether or not values that encode to fewer symbols than the
+	// segment are padded w/ zero symbols; if not, they are regenerated.
+	Pad bool `json:"pad"`
+}
+
+// UniformSegment returns the calibration under which segments of the given
+// length are uniformly distributed over every value they can encode, i.e.
+// [0, 62^length); each byte length is weighted by the share of those values
+// that have that many significant bytes, and values are padded. Uncalibrated
+// segments are not uniform, since the two random byte lengths they're drawn
+// from cover the range unevenly; this matters most for short segments.
+func UniformSegment(length int) SegmentProfile {
+	limit := new(big.Int).Exp(big.NewInt(schema.AlphabetSize), big.NewInt(int64(length)), nil)
+	total := new(big.Float).SetInt(limit)
+
+	// zero is the only value w/o a significant byte.
+	zero, _ := new(big.Float).Quo(big.NewFloat(1), total).Float64()
+	weights := map[int]float64{0: zero}
+	for n := 1; ; n++ {
+		// values w/ n significant bytes are in [2^(8(n-1)), 2^(8n)).
+		low := new(big.Int).Lsh(big.NewInt(1), uint(8*(n-1)))
+		if low.Cmp(limit) >= 0 {
+			break
+		}
+
+		high := new(big.Int).Lsh(big.NewInt(1), uint(8*n))
+		if high.Cmp(limit) > 0 {
+			high = limit
+		}
+
+		count := new(big.Float).SetInt(high.Sub(high, low))
+		weights[n], _ = count.Quo(count, total).Float64()
+	}
+
+	return SegmentProfile{ByteLengthWeights: weights, Pad: true}
+}
+
+// weighted is a set of choices w/ cumulative weights, for drawing a choice
+// in proportion to it's weight.
+type weighted[T any] struct {
+	choices    []T
+	cumulative []float64
+}
+
+// Build weighted choices from a map of weights; choices are sorted by key,
+// so that the same profile always draws the same choices from the same
+// random stream.
+func newWeighted[T int | string](weights map[T]float64) weighted[T] {
+	w := weighted[T]{
+		choices:    make([]T, 0, len(weights)),
+		cumulative: make([]float64, 0, len(weights)),
+	}
+
+	for k := range weights {
+		w.choices = append(w.choices, k)
+	}
+	sort.Slice(w.choices, func(i, j int) bool { return w.choices[i] < w.choices[j] })
+
+	total := 0.0
+	for _, k := range w.choices {
+		total += weights[k]
+		w.cumulative = append(w.cumulative, total)
+	}
+
+	return w
+}
+
+// Draw a choice, given a uniformly distributed value in [0, 1).
+func (w weighted[T]) draw(u float64) T {
+	target := u * w.cumulative[len(w.cumulative)-1]
+	i := sort.Search(len(w.cumulative), func(i int) bool { return w.cumulative[i] > target })
+	if i >= len(w.choices) {
+		i = len(w.choices) - 1
+	}
+
+	return w.choices[i]
+}
+
+// Check returns an error if the profile can't be used for generation, i.e.
+// it weights an unregistered prefix, has no positive weight in a set of
+// weights, or weights a byte length that can't fill it's segment.
+func (p *Profile) Check() error {
+	if err := checkWeights(p.PrefixWeights, func(prefix string) error {
+		if !IsValidPrefix(prefix) {
+			return fmt.Errorf("prefix '%s' is not a valid token prefix", prefix)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("invalid prefix weights: %w", err)
+	}
+
+	for length, seg := range p.Segments {
+		if length < 1 {
+			return fmt.Errorf("invalid segment length %d", length)
+		}
+
+		if len(seg.ByteLengthWeights) < 1 {
+			return fmt.Errorf("segment length %d has no byte length weights", length)
+		}
+
+		if err := checkWeights(seg.ByteLengthWeights, func(n int) error {
+			return checkByteLength(length, n, seg.Pad)
+		}); err != nil {
+			return fmt.Errorf("invalid byte length weights of segment length %d: %w", length, err)
+		}
+	}
+
+	return nil
+}
+
+// Check a set of weights, and each of it's keys w/ the given function.
+func checkWeights[T comparable](weights map[T]float64, check func(T) error) error {
+	if len(weights) < 1 {
+		return nil
+	}
+
+	total := 0.0
+	for k, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("weight of '%v' must not be negative", k)
+		}
+		if err := check(k); err != nil {
+			return err
+		}
+		total += w
+	}
+
+	if total <= 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+
+	return nil
+}
+
+// Check that a value w/ the given number of significant bytes can be encoded
+// into a segment of the given length; w/o padding, it must also be able to
+// encode to exactly the length.
+func checkByteLength(length, n int, pad bool) error {
+	alphabet := big.NewInt(schema.AlphabetSize)
+	limit := new(big.Int).Exp(alphabet, big.NewInt(int64(length)), nil)
+
+	switch {
+	case n < 0:
+		return fmt.Errorf("byte length %d must not be negative", n)
+	case n == 0 && !pad:
+		return fmt.Errorf("byte length 0 can't fill a segment w/o padding")
+	case n == 0:
+		return nil
+	}
+
+	// the smallest value w/ n significant bytes is 2^(8(n-1)).
+	smallest := new(big.Int).Lsh(big.NewInt(1), uint(8*(n-1)))
+	if smallest.Cmp(limit) >= 0 {
+		return fmt.Errorf("byte length %d overflows %d symbols", n, length)
+	}
+
+	// the largest value w/ n significant bytes is 2^(8n)-1.
+	floor := new(big.Int).Exp(alphabet, big.NewInt(int64(length-1)), nil)
+	largest := new(big.Int).Lsh(big.NewInt(1), uint(8*n))
+	if !pad && largest.Cmp(floor) <= 0 {
+		return fmt.Errorf("byte length %d can't fill %d symbols w/o padding", n, length)
+	}
+
+	return nil
+}
+
+// Fingerprint returns a hash of the calibration of the profile, i.e. every
+// member but it's Source, so tokens generated w/ different profiles can be
+// told apart; a nil profile has an empty fingerprint.
+func (p *Profile) Fingerprint() string {
+	if p == nil {
+		return ""
+	}
+
+	// maps are encoded w/ sorted keys, so equal calibrations encode equally.
+	data, err := json.Marshal(Profile{Source: "", PrefixWeights: p.PrefixWeights, Segments: p.Segments})
+	if err != nil {
+		// a profile only holds maps of numbers, which always encode.
+		panic(fmt.Sprintf("failed encoding profile: %v", err))
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadProfile reads a profile from the given reader, returning an error if
+// it can't be used for generation.
+func ReadProfile(r io.Reader) (*Profile, error) {
+	var p Profile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+
+	if err := p.Check(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+
+	return &p, nil
+}
+
+// LoadProfile reads the profile file at the given path; see ReadProfile.
+func LoadProfile(fileName string) (*Profile, error) {
+	file, err := os.Open(fileName) //#nosec:G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile: %w", err)
+	}
+
+	p, err := ReadProfile(file)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("failed to close profile: %w", cerr)
+	}
+
+	return p, err
+}
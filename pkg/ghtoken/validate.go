@@ -0,0 +1,177 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds the structured reasons a token
+// may fail schema validation.
+package ghtoken
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// Reasons a token may fail schema validation; every ValidationError wraps one
+// of these, so they can be tested for w/ errors.Is.
+var (
+	ErrMissingSeparator    = errors.New("missing separator")
+	ErrUnknownPrefix       = errors.New("unknown prefix")
+	ErrPayloadLength       = errors.New("wrong payload length")
+	ErrInvalidCharacter    = errors.New("character outside of the schema's base62 alphabet")
+	ErrUndecodableChecksum = errors.New("undecodable checksum")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+)
+
+// ValidationError holds one reason a token failed schema validation, along w/
+// the details of the failure; for length and checksum failures, the expected
+// and actual values are also populated.
+type ValidationError struct {
+	Reason   error
+	Detail   string
+	Expected string
+	Actual   string
+}
+
+// Error returns the reason and details of the validation failure.
+func (e *ValidationError) Error() string {
+	if len(e.Detail) < 1 {
+		return e.Reason.Error()
+	}
+
+	return fmt.Sprintf("%v: %s", e.Reason, e.Detail)
+}
+
+// Unwrap returns the reason of the validation failure.
+func (e *ValidationError) Unwrap() error {
+	return e.Reason
+}
+
+// ValidateToken parses the given token string and checks its schema; see
+// GhToken.Validate.
+func ValidateToken(tok string) error {
+	return ParseGhToken(tok).Validate()
+}
+
+// Validate checks the token's separator, prefix, payload length, alphabet,
+// and checksum against the schema of the token's prefix, returning nil if the
+// token appears to have a valid schema; otherwise, every reason the token is
+// invalid is returned as a *ValidationError, joined into a single error.
+// The checksum of schemas w/ an unverified checksum isn't checked. Validate
+// never panics, regardless of how malformed the token is, and does not modify
+// the token.
+func (token GhToken) Validate() error {
+	if !strings.Contains(token.FullToken, Sep) {
+		//nolint:exhaustruct
+		return &ValidationError{
+			Reason: ErrMissingSeparator,
+			Detail: fmt.Sprintf("expected '%s' between prefix and payload", Sep),
+		}
+	}
+
+	errs := make([]error, 0)
+	s, ok := GetSchema(token.Prefix)
+	if !ok {
+		//nolint:exhaustruct
+		errs = append(errs, &ValidationError{
+			Reason: ErrUnknownPrefix,
+			Detail: fmt.Sprintf("'%s' is not one of %s", token.Prefix, strings.Join(GetValidPrefixes(), ", ")),
+		})
+	}
+
+	if ok && !token.HasValidSegments() {
+		errs = append(errs, token.payloadLengthError(s))
+	}
+
+	errs = append(errs, token.alphabetErrors(s)...)
+
+	if s.UnverifiedChecksum {
+		return errors.Join(errs...)
+	}
+
+	if err := token.checksumError(s); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Build the error for a payload that doesn't match the given schema.
+func (token GhToken) payloadLengthError(s schema.Schema) *ValidationError {
+	if len(s.Segments) > 1 {
+		want := make([]string, 0, len(s.Segments))
+		for _, seg := range s.Segments {
+			want = append(want, fmt.Sprint(seg))
+		}
+
+		return &ValidationError{
+			Reason:   ErrPayloadLength,
+			Detail:   fmt.Sprintf("expected segments of %s characters", strings.Join(want, " and ")),
+			Expected: strings.Join(want, Sep),
+			Actual:   fmt.Sprintf("%d%s%d", len(token.EncodedID), Sep, len(token.EncodedSecret)),
+		}
+	}
+
+	return &ValidationError{
+		Reason:   ErrPayloadLength,
+		Detail:   fmt.Sprintf("expected %d characters, got %d", s.PayloadLength(), len(token.EncodedPayload)),
+		Expected: fmt.Sprint(s.PayloadLength()),
+		Actual:   fmt.Sprint(len(token.EncodedPayload)),
+	}
+}
+
+// Build an error for each character of the payload that falls outside of the
+// given schema's alphabet; separators are only permitted between the segments
+// of schemas w/ multiple segments. Positions are reported relative to the
+// start of the full token.
+func (token GhToken) alphabetErrors(s schema.Schema) []error {
+	errs := make([]error, 0)
+	offset := len(token.Prefix) + len(Sep)
+	for i := 0; i < len(token.EncodedPayload); i++ {
+		c := token.EncodedPayload[i]
+		if s.InAlphabet(c) || (s.SepAt(i) && string(c) == Sep) {
+			continue
+		}
+		//nolint:exhaustruct
+		errs = append(errs, &ValidationError{
+			Reason: ErrInvalidCharacter,
+			Detail: fmt.Sprintf("%q at position %d", c, offset+i),
+		})
+	}
+
+	return errs
+}
+
+// Build the error for a checksum that can't be decoded or doesn't match the
+// token input, according to the given schema, or return nil if the checksum
+// is valid.
+func (token GhToken) checksumError(s schema.Schema) *ValidationError {
+	if len(token.EncodedCrc) < 1 {
+		//nolint:exhaustruct
+		return &ValidationError{
+			Reason: ErrUndecodableChecksum,
+			Detail: "payload is too short to hold a checksum",
+		}
+	}
+
+	origCrc, ok := s.DecodeChecksum(token.EncodedCrc)
+	if !ok {
+		//nolint:exhaustruct
+		return &ValidationError{
+			Reason: ErrUndecodableChecksum,
+			Detail: fmt.Sprintf("'%s' does not decode to a 32 bit value", token.EncodedCrc),
+		}
+	}
+
+	if s.Checksum.Sum32(token.EncodedInput) == origCrc {
+		return nil
+	}
+
+	expected := s.EncodeChecksum(token.EncodedInput)
+
+	return &ValidationError{
+		Reason:   ErrChecksumMismatch,
+		Detail:   fmt.Sprintf("expected '%s', got '%s'", expected, token.EncodedCrc),
+		Expected: expected,
+		Actual:   token.EncodedCrc,
+	}
+}
@@ -0,0 +1,210 @@
+// Package ghtoken provides features for working with GitHub tokens.
+// This section of the ghtoken package holds byte slice views of tokens, and a
+// finder of them, for finding and validating large volumes of candidate tokens
+// w/o allocating.
+package ghtoken
+
+import (
+	"bytes"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+)
+
+// View is a read-only view of a token held in a byte slice; it is the
+// allocation-free counterpart of GhToken, as each of it's members is a
+// sub-slice of the original token rather than a copy. A View is only valid
+// for as long as the underlying slice isn't modified, and may be reused
+// across tokens by parsing into it again.
+type View struct {
+	Full    []byte
+	Prefix  []byte
+	Payload []byte
+	Input   []byte
+	Crc     []byte
+	// Schema is the schema of the token's prefix; it is the zero Schema if
+	// the prefix isn't registered.
+	Schema schema.Schema
+	// Known is whether or not the token's prefix is registered.
+	Known bool
+}
+
+// ParseView carves the given token into the given view, following the same
+// rules as ParseGhToken, but w/o validating it; it returns false if the token
+// doesn't contain a separator, in which case only Full is populated.
+func ParseView(tok []byte, v *View) bool {
+	*v = View{Full: bytes.TrimSpace(tok)} //nolint:exhaustruct
+
+	s, known := schema.MatchBytes(v.Full)
+	lead := len(s.Prefix) + len(Sep)
+	if !known {
+		i := bytes.IndexByte(v.Full, Sep[0])
+		if i < 0 {
+			return false
+		}
+		lead = i + len(Sep)
+	}
+
+	v.Schema = s
+	v.Known = known
+	v.Prefix = v.Full[:lead-len(Sep)]
+	v.Payload = v.Full[lead:]
+
+	if known && len(v.Payload) >= s.ChecksumLength {
+		v.Input = v.Payload[:len(v.Payload)-s.ChecksumLength]
+		v.Crc = v.Payload[len(v.Payload)-s.ChecksumLength:]
+	}
+
+	return true
+}
+
+// Valid returns whether or not the viewed token has a valid schema, i.e. a
+// registered prefix, a payload of the expected layout and alphabet, and a
+// matching checksum (unless the schema's checksum is unverified); it agrees
+// w/ GhToken.Validate returning nil, but never allocates.
+func (v *View) Valid() bool {
+	s := &v.Schema
+	if !v.Known || len(v.Payload) != s.PayloadLength() {
+		return false
+	}
+
+	c := s.Codec()
+	for i, b := range v.Payload {
+		if s.SepAt(i) {
+			if b != Sep[0] {
+				return false
+			}
+
+			continue
+		}
+
+		if !c.Valid(b) {
+			return false
+		}
+	}
+
+	return s.UnverifiedChecksum || v.HasValidChecksum()
+}
+
+// HasValidChecksum returns whether or not the viewed token's checksum matches
+// it's input, even if the schema's checksum is unverified; see
+// GhToken.HasValidChecksum.
+func (v *View) HasValidChecksum() bool {
+	crc, ok := v.Schema.DecodeChecksumBytes(v.Crc)
+
+	return ok && v.Schema.Sum32Bytes(v.Input) == crc
+}
+
+// ValidBytes returns whether or not the given token has a valid schema; see
+// View.Valid.
+func ValidBytes(tok []byte) bool {
+	var v View
+	if !ParseView(tok, &v) {
+		return false
+	}
+
+	return v.Valid()
+}
+
+// Finder finds token candidates in byte slices, like FindAll, but w/o
+// allocating once it's created: each candidate is parsed into a View, rather
+// than a GhToken, so callers decide which candidates are worth keeping (e.g.
+// only those where View.Valid). The registered schemas are captured when it's
+// created. Like a View, a Finder is only valid for as long as the text it's
+// reset w/ isn't modified, and isn't safe for concurrent use.
+type Finder struct {
+	schemas []schema.Schema
+	leads   [][]byte
+	// starts and ends hold the next candidate of each schema, at or after the
+	// last one found; a start of -1 means there are none left.
+	starts []int
+	ends   []int
+	text   []byte
+	to     int
+}
+
+// NewFinder returns a Finder of candidates of the registered schemas.
+func NewFinder() *Finder {
+	schemas := schema.Default().Schemas()
+	f := &Finder{
+		schemas: schemas,
+		leads:   make([][]byte, len(schemas)),
+		starts:  make([]int, len(schemas)),
+		ends:    make([]int, len(schemas)),
+		text:    nil,
+		to:      0,
+	}
+	for i, s := range schemas {
+		f.leads[i] = []byte(s.Prefix + Sep)
+	}
+
+	return f
+}
+
+// Reset makes the finder find the candidates in the given text that start at
+// or after from and before to; the text around a candidate decides whether or
+// not it's part of a longer word, and the edges of the text count as
+// boundaries.
+func (f *Finder) Reset(text []byte, from, to int) {
+	f.text, f.to = text, min(to, len(text))
+	for i := range f.schemas {
+		f.search(i, from)
+	}
+}
+
+// Next parses the next candidate, in the order they appear, into the given
+// view, and returns it's start and end offsets in the text (i.e.
+// text[start:end] is the candidate); it returns false once there are no
+// candidates left. When candidates of multiple schemas start at the same
+// offset, only the first, by schema name, is found.
+func (f *Finder) Next(v *View) (int, int, bool) {
+	next := -1
+	for i, start := range f.starts {
+		if start >= 0 && (next < 0 || start < f.starts[next]) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return 0, 0, false
+	}
+
+	start, end := f.starts[next], f.ends[next]
+	for i := range f.schemas {
+		if f.starts[i] == start {
+			f.search(i, start+1)
+		}
+	}
+	ParseView(f.text[start:end], v)
+
+	return start, end, true
+}
+
+// Search for the next candidate of the schema at the given index, that starts
+// at or after from.
+func (f *Finder) search(i, from int) {
+	s, lead := &f.schemas[i], f.leads[i]
+	f.starts[i] = -1
+	for off := from; off < f.to; {
+		j := bytes.Index(f.text[off:], lead)
+		if j < 0 || off+j >= f.to {
+			return
+		}
+		start := off + j
+		off = start + 1
+
+		if start > 0 && isWordByte(s, f.text[start-1]) {
+			continue
+		}
+
+		end := start + len(lead)
+		for end < len(f.text) && isPayloadByte(s, f.text[end]) {
+			end++
+		}
+		if end-start-len(lead) != s.PayloadLength() || (end < len(f.text) && isWordByte(s, f.text[end])) {
+			continue
+		}
+
+		f.starts[i], f.ends[i] = start, end
+
+		return
+	}
+}
@@ -0,0 +1,227 @@
+// Package issuer provides a library for issuing GitHub-style tokens; issued
+// tokens are never stored, only their hashes are, and presented tokens are
+// verified against the stored hashes in constant time. Tokens of prefixes
+// that have a lifetime expire once their lifetime has elapsed, and any token
+// may be revoked before then.
+//
+// Compatibility: see the ghtoken package; the same guarantees apply here,
+// and the json field names of Record are not renamed.
+package issuer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pyqlsa/token-forge/pkg/ghtoken"
+)
+
+// Reasons a presented token may fail verification.
+var (
+	ErrInvalidToken = errors.New("token does not match a known schema")
+	ErrUnknownToken = errors.New("token was not issued")
+	ErrExpired      = errors.New("token has expired")
+	ErrRevoked      = errors.New("token has been revoked")
+)
+
+// maxIssueAttempts bounds the number of times a token is regenerated when it
+// collides w/ a previously issued token; w/ 62^30 possible inputs, even one
+// retry should never happen.
+const maxIssueAttempts = 3
+
+// DefaultLifetimes returns the lifetimes of GitHub's token types that expire
+// by default; ghs tokens expire after 1 hour and ghu tokens expire after 8
+// hours (see the ghtoken package), while other prefixes are long-lived.
+func DefaultLifetimes() map[string]time.Duration {
+	return map[string]time.Duration{
+		"ghs": time.Hour,
+		"ghu": 8 * time.Hour,
+	}
+}
+
+// Record is what is stored for each issued token.
+type Record struct {
+	// Hash is the hex encoded SHA-256 hash of the token; it also serves as the
+	// record's key in a Store.
+	Hash      string    `json:"hash"`
+	Prefix    string    `json:"prefix"`
+	Subject   string    `json:"subject,omitempty"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"` // zero value never expires
+	RevokedAt time.Time `json:"revokedAt"` // zero value isn't revoked
+}
+
+// Expired returns whether or not the record has expired at the given time.
+func (r Record) Expired(at time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !at.Before(r.ExpiresAt)
+}
+
+// Revoked returns whether or not the record has been revoked.
+func (r Record) Revoked() bool {
+	return !r.RevokedAt.IsZero()
+}
+
+// Issuer issues, verifies, and revokes tokens, keeping records in a Store.
+type Issuer struct {
+	store     Store
+	lifetimes map[string]time.Duration
+	now       func() time.Time
+	generate  func(prefix string) *ghtoken.GhToken
+}
+
+// Option configures an Issuer.
+type Option func(*Issuer)
+
+// WithLifetime sets the lifetime of tokens w/ the given prefix; a lifetime
+// <= 0 means tokens w/ the prefix never expire.
+func WithLifetime(prefix string, lifetime time.Duration) Option {
+	return func(i *Issuer) {
+		i.lifetimes[prefix] = lifetime
+	}
+}
+
+// WithClock sets the function the issuer uses to tell the time.
+func WithClock(now func() time.Time) Option {
+	return func(i *Issuer) {
+		i.now = now
+	}
+}
+
+// New returns an Issuer that keeps records in the given store; unless
+// configured otherwise, tokens are issued w/ DefaultLifetimes.
+func New(store Store, opts ...Option) *Issuer {
+	i := &Issuer{
+		store:     store,
+		lifetimes: DefaultLifetimes(),
+		now:       time.Now,
+		generate:  ghtoken.Generate,
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Hash returns the hex encoded SHA-256 hash of the given token, as it is
+// stored in a Record.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue generates a new token w/ the given prefix for the given subject,
+// stores the hash of the token, and returns the token alongside its record;
+// the token itself is not retained, so it must be handed to the subject.
+func (i *Issuer) Issue(ctx context.Context, prefix, subject string) (string, Record, error) {
+	if !ghtoken.IsValidPrefix(prefix) {
+		return "", Record{}, fmt.Errorf("prefix '%s' is not a valid token prefix", prefix) //nolint:exhaustruct
+	}
+
+	var err error
+	for attempt := 0; attempt < maxIssueAttempts; attempt++ {
+		token := i.generate(prefix)
+		issuedAt := i.now().UTC()
+		//nolint:exhaustruct
+		rec := Record{
+			Hash:     Hash(token.FullToken),
+			Prefix:   prefix,
+			Subject:  subject,
+			IssuedAt: issuedAt,
+		}
+		if lifetime := i.lifetimes[prefix]; lifetime > 0 {
+			rec.ExpiresAt = issuedAt.Add(lifetime)
+		}
+
+		err = i.store.Put(ctx, rec)
+		if err == nil {
+			return token.FullToken, rec, nil
+		}
+		if !errors.Is(err, ErrExists) {
+			break
+		}
+	}
+
+	return "", Record{}, fmt.Errorf("failed issuing token: %w", err) //nolint:exhaustruct
+}
+
+// Verify checks that the given token was issued, and that it has neither
+// expired nor been revoked, returning its record. Tokens that don't match a
+// registered schema (including a valid checksum) are rejected before the
+// store is consulted.
+func (i *Issuer) Verify(ctx context.Context, token string) (Record, error) {
+	rec, err := i.lookup(ctx, token)
+	if err != nil {
+		return rec, err
+	}
+
+	switch {
+	case rec.Revoked():
+		return rec, ErrRevoked
+	case rec.Expired(i.now()):
+		return rec, ErrExpired
+	default:
+		return rec, nil
+	}
+}
+
+// Revoke revokes the given token, so that it no longer verifies; revoking a
+// token that has already been revoked is a no-op.
+func (i *Issuer) Revoke(ctx context.Context, token string) error {
+	rec, err := i.lookup(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if rec.Revoked() {
+		return nil
+	}
+
+	if err := i.store.Revoke(ctx, rec.Hash, i.now().UTC()); err != nil {
+		return fmt.Errorf("failed revoking token: %w", err)
+	}
+
+	return nil
+}
+
+// Prune removes the records of every token that has expired, returning the
+// number of records removed.
+func (i *Issuer) Prune(ctx context.Context) (int, error) {
+	n, err := i.store.Prune(ctx, i.now())
+	if err != nil {
+		return n, fmt.Errorf("failed pruning expired tokens: %w", err)
+	}
+
+	return n, nil
+}
+
+// lookup validates the schema of the given token, then finds its record; the
+// hash of the record is compared to the hash of the token in constant time,
+// so that stores which don't look records up by exact key can't leak timing
+// information about stored hashes.
+func (i *Issuer) lookup(ctx context.Context, token string) (Record, error) {
+	if err := ghtoken.ValidateToken(token); err != nil {
+		return Record{}, fmt.Errorf("%w: %w", ErrInvalidToken, err) //nolint:exhaustruct
+	}
+
+	hash := Hash(token)
+	rec, err := i.store.Get(ctx, hash)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return rec, ErrUnknownToken
+	case err != nil:
+		return rec, fmt.Errorf("failed looking up token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(hash)) != 1 {
+		return Record{}, ErrUnknownToken //nolint:exhaustruct
+	}
+
+	return rec, nil
+}
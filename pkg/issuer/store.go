@@ -0,0 +1,259 @@
+// Package issuer provides a library for issuing GitHub-style tokens.
+// This section of the issuer package holds the storage backends for records
+// of issued tokens.
+package issuer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pyqlsa/token-forge/internal/fileutil"
+)
+
+// Errors returned by Store implementations.
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrExists   = errors.New("record already exists")
+)
+
+// Store is a storage backend for records of issued tokens, keyed by the hash
+// of each token; implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds a new record, returning ErrExists if a record w/ the same hash
+	// already exists.
+	Put(ctx context.Context, rec Record) error
+	// Get returns the record w/ the given hash, returning ErrNotFound if no
+	// such record exists.
+	Get(ctx context.Context, hash string) (Record, error)
+	// Revoke marks the record w/ the given hash as revoked at the given time,
+	// returning ErrNotFound if no such record exists.
+	Revoke(ctx context.Context, hash string, at time.Time) error
+	// Prune removes every record that has expired at the given time,
+	// returning the number of records removed.
+	Prune(ctx context.Context, at time.Time) (int, error)
+}
+
+// MemoryStore is a Store that keeps records in memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	//nolint:exhaustruct
+	return &MemoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+// Put adds a new record.
+func (m *MemoryStore) Put(_ context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exist := m.records[rec.Hash]; exist {
+		return ErrExists
+	}
+	m.records[rec.Hash] = rec
+
+	return nil
+}
+
+// Get returns the record w/ the given hash.
+func (m *MemoryStore) Get(_ context.Context, hash string) (Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rec, exist := m.records[hash]
+	if !exist {
+		return rec, ErrNotFound
+	}
+
+	return rec, nil
+}
+
+// Revoke marks the record w/ the given hash as revoked.
+func (m *MemoryStore) Revoke(_ context.Context, hash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, exist := m.records[hash]
+	if !exist {
+		return ErrNotFound
+	}
+	rec.RevokedAt = at
+	m.records[hash] = rec
+
+	return nil
+}
+
+// Prune removes every record that has expired at the given time.
+func (m *MemoryStore) Prune(_ context.Context, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(prune(m.records, at)), nil
+}
+
+// prune removes every record in the given map that has expired at the given
+// time, returning the records removed.
+func prune(records map[string]Record, at time.Time) []Record {
+	pruned := make([]Record, 0)
+	for hash, rec := range records {
+		if rec.Expired(at) {
+			delete(records, hash)
+			pruned = append(pruned, rec)
+		}
+	}
+
+	return pruned
+}
+
+// FileStore is a Store that keeps records in memory, and persists them as
+// json to a file after every change; writes replace the file atomically, so
+// the file is never left partially written. Since every change rewrites every
+// record, issuing N tokens writes O(N^2) bytes in total; a FileStore suits
+// stores of up to a few thousand live records (pruned regularly), and larger
+// ones should implement Store on top of a database.
+type FileStore struct {
+	mu       sync.RWMutex
+	fileName string
+	records  map[string]Record
+}
+
+// OpenFileStore returns a FileStore backed by the given file, loading any
+// records already in the file; the file is created on the first change if it
+// doesn't already exist.
+func OpenFileStore(fileName string) (*FileStore, error) {
+	//nolint:exhaustruct
+	f := &FileStore{
+		fileName: fileName,
+		records:  make(map[string]Record),
+	}
+
+	data, err := os.ReadFile(fileName) //#nosec:G304
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return f, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f.records); err != nil {
+		return nil, fmt.Errorf("failed to parse token store '%s': %w", fileName, err)
+	}
+
+	return f, nil
+}
+
+// Put adds a new record.
+func (f *FileStore) Put(_ context.Context, rec Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exist := f.records[rec.Hash]; exist {
+		return ErrExists
+	}
+	f.records[rec.Hash] = rec
+
+	if err := f.save(); err != nil {
+		delete(f.records, rec.Hash)
+
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the record w/ the given hash.
+func (f *FileStore) Get(_ context.Context, hash string) (Record, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	rec, exist := f.records[hash]
+	if !exist {
+		return rec, ErrNotFound
+	}
+
+	return rec, nil
+}
+
+// Revoke marks the record w/ the given hash as revoked.
+func (f *FileStore) Revoke(_ context.Context, hash string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rec, exist := f.records[hash]
+	if !exist {
+		return ErrNotFound
+	}
+	prev := rec
+	rec.RevokedAt = at
+	f.records[hash] = rec
+
+	if err := f.save(); err != nil {
+		f.records[hash] = prev
+
+		return err
+	}
+
+	return nil
+}
+
+// Prune removes every record that has expired at the given time.
+func (f *FileStore) Prune(_ context.Context, at time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pruned := prune(f.records, at)
+	if len(pruned) < 1 {
+		return 0, nil
+	}
+
+	if err := f.save(); err != nil {
+		for _, rec := range pruned {
+			f.records[rec.Hash] = rec
+		}
+
+		return 0, err
+	}
+
+	return len(pruned), nil
+}
+
+// save writes every record to a temporary file next to the store's file,
+// then renames it over the store's file; the caller must hold the lock.
+func (f *FileStore) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.fileName), filepath.Base(f.fileName)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary token store: %w", err)
+	}
+
+	if err := fileutil.WriteJSON(tmp, f.records); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to close temporary token store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.fileName); err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to replace token store: %w", err)
+	}
+
+	return nil
+}
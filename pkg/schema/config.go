@@ -0,0 +1,158 @@
+// Package schema provides a registry of checksummed token schemas.
+// This section of the schema package holds the config file format used to
+// declare custom schemas.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// AlphabetNameGitHub names GitHubAlphabet in a config file.
+	AlphabetNameGitHub = "github"
+	// AlphabetNameBigInt names BigIntAlphabet in a config file.
+	AlphabetNameBigInt = "bigint"
+)
+
+// Config is the format of a config file declaring custom schemas, e.g.:
+//
+//	{
+//	    "schemas": [
+//	        {
+//	            "name": "acme-service",
+//	            "prefix": "acme",
+//	            "bodyLength": 30,
+//	            "alphabet": "github",
+//	            "checksum": "crc32c"
+//	        }
+//	    ]
+//	}
+type Config struct {
+	Schemas []SchemaConfig `json:"schemas"`
+}
+
+// SchemaConfig declares a custom schema w/ a single payload segment made up
+// of a random body followed by the encoded checksum of the body. Alphabet may
+// be "github" (0-9,A-Z,a-z; the default), "bigint" (0-9,a-z,A-Z), or any
+// other ordering of 62 symbols. Checksum may be the name of any supported
+// checksum algorithm, defaulting to "crc32-ieee". ChecksumLength defaults to
+// 6, the fewest characters that can hold a 32 bit checksum.
+type SchemaConfig struct {
+	Name           string `json:"name"`
+	Prefix         string `json:"prefix"`
+	BodyLength     int    `json:"bodyLength"`
+	ChecksumLength int    `json:"checksumLength,omitempty"`
+	Alphabet       string `json:"alphabet,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+}
+
+// Schema builds the schema declared by the config, returning an error if the
+// declared schema is not usable.
+func (c SchemaConfig) Schema() (Schema, error) {
+	crcLength := c.ChecksumLength
+	if crcLength == 0 {
+		crcLength = minChecksumLength
+	}
+
+	var alphabet string
+	switch c.Alphabet {
+	case "", AlphabetNameGitHub:
+		alphabet = GitHubAlphabet
+	case AlphabetNameBigInt:
+		alphabet = BigIntAlphabet
+	default:
+		alphabet = c.Alphabet
+	}
+
+	crcName := c.Checksum
+	if len(crcName) < 1 {
+		crcName = CRC32IEEE.Name()
+	}
+
+	crc, ok := LookupChecksum(crcName)
+	if !ok {
+		names := make([]string, 0)
+		for _, c := range Checksums() {
+			names = append(names, c.Name())
+		}
+
+		return Schema{}, fmt.Errorf("schema '%s' has unsupported checksum '%s'; must be one of %s", c.Name, crcName, strings.Join(names, ", ")) //nolint:exhaustruct
+	}
+
+	s := Schema{
+		Name:               c.Name,
+		Prefix:             c.Prefix,
+		Segments:           []int{c.BodyLength + crcLength},
+		ChecksumLength:     crcLength,
+		Alphabet:           alphabet,
+		Checksum:           crc,
+		UnverifiedChecksum: false,
+	}
+
+	if c.BodyLength < 1 {
+		return s, fmt.Errorf("schema '%s' must have a body length of at least 1", c.Name)
+	}
+
+	if err := s.Check(); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// ReadConfig reads a config from the given reader, returning the schemas it
+// declares.
+func ReadConfig(r io.Reader) ([]Schema, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode schema config: %w", err)
+	}
+
+	schemas := make([]Schema, 0, len(cfg.Schemas))
+	for _, c := range cfg.Schemas {
+		s, err := c.Schema()
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema config: %w", err)
+		}
+		schemas = append(schemas, s)
+	}
+
+	return schemas, nil
+}
+
+// LoadFile reads the config file at the given path and registers every schema
+// it declares w/ the given registry.
+func (r *Registry) LoadFile(fileName string) error {
+	file, err := os.Open(fileName) //#nosec:G304
+	if err != nil {
+		return fmt.Errorf("failed to open schema config: %w", err)
+	}
+
+	schemas, err := ReadConfig(file)
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("failed to close schema config: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			return fmt.Errorf("failed loading schema config '%s': %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadFile reads the config file at the given path and registers every schema
+// it declares w/ the default registry; see Registry.LoadFile.
+func LoadFile(fileName string) error {
+	return defaultRegistry.LoadFile(fileName)
+}
@@ -0,0 +1,276 @@
+// Package schema provides a registry of checksummed token schemas.
+// This section of the schema package holds the registry and the built-in
+// schemas.
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Layouts of the built-in GitHub schemas.
+const (
+	// GitHubPayloadLength is the payload length of most GitHub tokens.
+	GitHubPayloadLength = 36
+	// GitHubChecksumLength is the checksum length of all GitHub tokens.
+	GitHubChecksumLength = 6
+	// GitHubRefreshPayloadLength is the payload length of GitHub refresh
+	// tokens.
+	GitHubRefreshPayloadLength = 76
+	// GitHubFineGrainedPrefix is the prefix of GitHub fine-grained personal
+	// access tokens; unlike other prefixes, it contains the separator.
+	GitHubFineGrainedPrefix = "github" + Sep + "pat"
+	// GitHubFineGrainedIDLength is the length of the first (identifier)
+	// segment of a fine-grained token's payload.
+	GitHubFineGrainedIDLength = 22
+	// GitHubFineGrainedSecretLength is the length of the second (secret)
+	// segment of a fine-grained token's payload, including the checksum.
+	GitHubFineGrainedSecretLength = 59
+)
+
+// Built-in schemas; see the ghtoken package for notes on each of the GitHub
+// token types. npm tokens follow GitHub's design, down to the payload length
+// (https://github.blog/changelog/2021-09-23-npm-has-a-new-access-token-format/).
+// GitHub documents neither the checksum of refresh tokens nor that of
+// fine-grained tokens, so their checksums are unverified.
+var (
+	GitHubPAT = Schema{
+		Name: "github-pat", Prefix: "ghp", Segments: []int{GitHubPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: false,
+	}
+	GitHubOAuth = Schema{
+		Name: "github-oauth", Prefix: "gho", Segments: []int{GitHubPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: false,
+	}
+	GitHubUserToServer = Schema{
+		Name: "github-user-to-server", Prefix: "ghu", Segments: []int{GitHubPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: false,
+	}
+	GitHubServerToServer = Schema{
+		Name: "github-server-to-server", Prefix: "ghs", Segments: []int{GitHubPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: false,
+	}
+	GitHubRefresh = Schema{
+		Name: "github-refresh", Prefix: "ghr", Segments: []int{GitHubRefreshPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: true,
+	}
+	GitHubFineGrainedPAT = Schema{
+		Name: "github-fine-grained-pat", Prefix: GitHubFineGrainedPrefix, Segments: []int{GitHubFineGrainedIDLength, GitHubFineGrainedSecretLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: true,
+	}
+	NpmAccessToken = Schema{
+		Name: "npm", Prefix: "npm", Segments: []int{GitHubPayloadLength},
+		ChecksumLength: GitHubChecksumLength, Alphabet: GitHubAlphabet, Checksum: CRC32IEEE,
+		UnverifiedChecksum: false,
+	}
+)
+
+// Builtin returns the built-in schemas, in the order they are registered in
+// the default registry.
+func Builtin() []Schema {
+	return []Schema{
+		GitHubPAT,
+		GitHubOAuth,
+		GitHubUserToServer,
+		GitHubServerToServer,
+		GitHubRefresh,
+		GitHubFineGrainedPAT,
+		NpmAccessToken,
+	}
+}
+
+// Unknown returns the schema assumed for tokens w/ the given, unregistered
+// prefix; it follows the layout of most GitHub tokens.
+func Unknown(prefix string) Schema {
+	s := GitHubPAT
+	s.Name = "unknown"
+	s.Prefix = prefix
+
+	return s
+}
+
+// Registry holds a set of schemas, keyed by prefix; it is safe for concurrent
+// use.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]Schema
+	order   []string
+	// byLead holds every schema, sorted by descending prefix length, so that
+	// the first schema to match a token is the longest match.
+	byLead []Schema
+}
+
+// NewRegistry returns a registry populated w/ the given schemas, or an error
+// if any of the schemas can't be registered.
+func NewRegistry(schemas ...Schema) (*Registry, error) {
+	//nolint:exhaustruct
+	r := &Registry{
+		schemas: make(map[string]Schema),
+	}
+
+	for _, s := range schemas {
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// defaultRegistry is the registry used by the package level functions.
+var defaultRegistry = mustNewRegistry(Builtin()...)
+
+// mustNewRegistry is like NewRegistry, but panics on error; only for
+// initializing package level variables.
+func mustNewRegistry(schemas ...Schema) *Registry {
+	r, err := NewRegistry(schemas...)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// Default returns the default registry, which is populated w/ the built-in
+// schemas.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds the given schema to the registry, returning an error if the
+// schema is not usable, or if a schema w/ the same name or prefix has
+// already been registered.
+func (r *Registry) Register(s Schema) error {
+	if err := s.Check(); err != nil {
+		return fmt.Errorf("failed registering schema: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, found := r.schemas[s.Prefix]; found {
+		return fmt.Errorf("prefix '%s' of schema '%s' is already registered by schema '%s'", s.Prefix, s.Name, existing.Name)
+	}
+
+	for _, existing := range r.schemas {
+		if existing.Name == s.Name {
+			return fmt.Errorf("schema '%s' is already registered", s.Name)
+		}
+	}
+
+	r.schemas[s.Prefix] = s
+	r.order = append(r.order, s.Prefix)
+	r.byLead = append(r.byLead, s)
+	sort.SliceStable(r.byLead, func(i, j int) bool { return len(r.byLead[i].Prefix) > len(r.byLead[j].Prefix) })
+
+	return nil
+}
+
+// Lookup returns the schema registered w/ the given prefix.
+func (r *Registry) Lookup(prefix string) (Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, found := r.schemas[prefix]
+
+	return s, found
+}
+
+// Match returns the schema whose prefix (followed by the separator) begins
+// the given token, along w/ the rest of the token (i.e. the payload); when
+// multiple prefixes match, the longest wins. If no registered prefix matches,
+// the token is cut at the first separator, and the Unknown schema for the
+// resulting prefix is returned, along w/ false; if the token doesn't contain
+// a separator at all, an empty payload and false are returned.
+func (r *Registry) Match(tok string) (Schema, string, bool) {
+	if s, ok := match(r, tok); ok {
+		return s, tok[len(s.Prefix)+len(Sep):], true
+	}
+
+	prefix, pl, _ := strings.Cut(tok, Sep)
+
+	return Unknown(prefix), pl, false
+}
+
+// MatchBytes returns the schema whose prefix (followed by the separator)
+// begins the given token, like Match, but w/o allocating; the payload of a
+// matched token starts len(Prefix)+len(Sep) bytes in. If no registered prefix
+// matches, the zero Schema and false are returned.
+func (r *Registry) MatchBytes(tok []byte) (Schema, bool) {
+	return match(r, tok)
+}
+
+// Find the longest registered prefix (followed by the separator) that
+// begins the given token; comparing string conversions of byte slices is
+// optimized by the compiler, and never allocates.
+func match[T string | []byte](r *Registry, tok T) (Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.byLead {
+		n := len(s.Prefix)
+		if len(tok) >= n+len(Sep) && string(tok[:n]) == s.Prefix && string(tok[n:n+len(Sep)]) == Sep {
+			return s, true
+		}
+	}
+
+	return Schema{}, false //nolint:exhaustruct
+}
+
+// Prefixes returns the prefixes of every registered schema, in the order
+// they were registered.
+func (r *Registry) Prefixes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p := make([]string, len(r.order))
+	copy(p, r.order)
+
+	return p
+}
+
+// Schemas returns every registered schema, sorted by name.
+func (r *Registry) Schemas() []Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s := make([]Schema, 0, len(r.schemas))
+	for _, v := range r.schemas {
+		s = append(s, v)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Name < s[j].Name })
+
+	return s
+}
+
+// Register adds the given schema to the default registry; see
+// Registry.Register.
+func Register(s Schema) error {
+	return defaultRegistry.Register(s)
+}
+
+// Lookup returns the schema registered w/ the given prefix in the default
+// registry; see Registry.Lookup.
+func Lookup(prefix string) (Schema, bool) {
+	return defaultRegistry.Lookup(prefix)
+}
+
+// Match matches the given token against the default registry; see
+// Registry.Match.
+func Match(tok string) (Schema, string, bool) {
+	return defaultRegistry.Match(tok)
+}
+
+// MatchBytes matches the given token against the default registry; see
+// Registry.MatchBytes.
+func MatchBytes(tok []byte) (Schema, bool) {
+	return defaultRegistry.MatchBytes(tok)
+}
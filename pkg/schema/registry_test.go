@@ -0,0 +1,162 @@
+// Package schema_test provides tests for the schema package.
+package schema_test
+
+import (
+	"hash/adler32"
+	"hash/crc32"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	"github.com/pyqlsa/token-forge/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	custom := schema.GitHubPAT
+	custom.Name = "custom"
+	custom.Prefix = "cst"
+	testcases := []struct {
+		name  string
+		mod   func(s schema.Schema) schema.Schema
+		valid bool
+	}{
+		{
+			name: "valid", mod: func(s schema.Schema) schema.Schema { return s }, valid: true,
+		},
+		{
+			name: "duplicate prefix", mod: func(s schema.Schema) schema.Schema { s.Prefix = "ghp"; return s }, valid: false,
+		},
+		{
+			name: "duplicate name", mod: func(s schema.Schema) schema.Schema { s.Name = "github-pat"; return s }, valid: false,
+		},
+		{
+			name: "short alphabet", mod: func(s schema.Schema) schema.Schema { s.Alphabet = s.Alphabet[1:]; return s }, valid: false,
+		},
+		{
+			name: "repeated symbol", mod: func(s schema.Schema) schema.Schema { s.Alphabet = "a" + s.Alphabet[1:]; return s }, valid: false,
+		},
+		{
+			name: "short checksum", mod: func(s schema.Schema) schema.Schema { s.ChecksumLength = 5; return s }, valid: false,
+		},
+		{
+			name: "no room for input", mod: func(s schema.Schema) schema.Schema { s.Segments = []int{6}; return s }, valid: false,
+		},
+		{
+			name: "no checksum", mod: func(s schema.Schema) schema.Schema { s.Checksum = nil; return s }, valid: false,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := schema.NewRegistry(schema.Builtin()...)
+			assert.NoError(t, err)
+			err = r.Register(tc.mod(custom))
+			assert.Equal(t, tc.valid, err == nil, "unexpected registration result: %v", err)
+		})
+	}
+}
+
+//nolint:paralleltest // testing.AllocsPerRun panics in parallel tests
+func TestChecksums(t *testing.T) {
+	fnv1a := func(b []byte) uint32 {
+		h := fnv.New32a()
+		_, _ = h.Write(b)
+
+		return h.Sum32()
+	}
+	expected := map[string]func([]byte) uint32{
+		"crc32-ieee": crc32.ChecksumIEEE,
+		"crc32c":     func(b []byte) uint32 { return crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)) },
+		"adler32":    adler32.Checksum,
+		"fnv1a-32":   fnv1a,
+	}
+	inputs := []string{"", "c7s0WCCU63BJ4ZHMbv2WC7p3W0tsdk", strings.Repeat("\xffz", 3000)}
+	for _, c := range schema.Checksums() {
+		sum, ok := expected[c.Name()]
+		if !assert.True(t, ok, "unexpected checksum '%s'", c.Name()) {
+			continue
+		}
+		for _, in := range inputs {
+			assert.Equal(t, sum([]byte(in)), c.Sum32(in), "unexpected %s of a string", c.Name())
+			assert.Equal(t, sum([]byte(in)), c.(schema.BytesChecksum).Sum32Bytes([]byte(in)), "unexpected %s of bytes", c.Name()) //nolint:forcetypeassert
+		}
+
+		allocs := testing.AllocsPerRun(100, func() { c.Sum32(inputs[1]) })
+		assert.Zero(t, allocs, "checksumming a string w/ %s should not allocate", c.Name())
+	}
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		token   string
+		name    string
+		payload string
+		found   bool
+	}{
+		{token: "ghp_abc", name: "github-pat", payload: "abc", found: true},
+		{token: "github_pat_abc_def", name: "github-fine-grained-pat", payload: "abc_def", found: true},
+		{token: "npm_abc", name: "npm", payload: "abc", found: true},
+		{token: "github_abc", name: "unknown", payload: "abc", found: false},
+		{token: "abc", name: "unknown", payload: "", found: false},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.token, func(t *testing.T) {
+			t.Parallel()
+			s, payload, found := schema.Match(tc.token)
+			assert.Equal(t, tc.name, s.Name)
+			assert.Equal(t, tc.payload, payload)
+			assert.Equal(t, tc.found, found)
+		})
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{
+			name:   "defaults",
+			config: `{"schemas": [{"name": "acme", "prefix": "acme", "bodyLength": 30}]}`,
+			valid:  true,
+		},
+		{
+			name:   "custom alphabet and checksum",
+			config: `{"schemas": [{"name": "acme", "prefix": "acme", "bodyLength": 30, "alphabet": "bigint", "checksum": "adler32", "checksumLength": 8}]}`,
+			valid:  true,
+		},
+		{
+			name:   "unsupported checksum",
+			config: `{"schemas": [{"name": "acme", "prefix": "acme", "bodyLength": 30, "checksum": "md5"}]}`,
+			valid:  false,
+		},
+		{
+			name:   "missing body",
+			config: `{"schemas": [{"name": "acme", "prefix": "acme"}]}`,
+			valid:  false,
+		},
+		{
+			name:   "unknown field",
+			config: `{"schemas": [{"name": "acme", "prefix": "acme", "bodyLength": 30, "length": 36}]}`,
+			valid:  false,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc // magic to capture range variable, otherwise we might not actually test all cases
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			schemas, err := schema.ReadConfig(strings.NewReader(tc.config))
+			assert.Equal(t, tc.valid, err == nil, "unexpected config result: %v", err)
+			if tc.valid {
+				assert.Len(t, schemas, 1)
+			}
+		})
+	}
+}
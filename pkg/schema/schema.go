@@ -0,0 +1,409 @@
+// Package schema provides a registry of checksummed token schemas, i.e.
+// tokens made up of a greppable prefix, a separator, and a base62 payload
+// that ends w/ an encoded checksum of the rest of the payload.
+//
+// Compatibility: see the ghtoken package; the same guarantees apply here,
+// and the names of built-in schemas and checksum algorithms are stable.
+package schema
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"strings"
+	"sync"
+
+	"github.com/pyqlsa/token-forge/pkg/base62"
+	"github.com/pyqlsa/token-forge/pkg/datautil"
+)
+
+const (
+	// Sep is the character that separates a token's prefix from it's payload,
+	// and the segments of a multi-segment payload from each other.
+	Sep = "_"
+	// AlphabetSize is the number of symbols in a base62 alphabet.
+	AlphabetSize = base62.AlphabetSize
+	// BigIntAlphabet is the base62 alphabet used by Golang's big.Int package.
+	BigIntAlphabet = base62.BigIntAlphabet
+	// GitHubAlphabet is the base62 alphabet used by GitHub (and others that
+	// follow GitHub's token design); it is the inversion of BigIntAlphabet.
+	GitHubAlphabet = base62.GitHubAlphabet
+	// _32Bit "enum" so we're not using magic numbers; 32 bits = 4 * 1 byte.
+	_32Bit = 4
+	// minChecksumLength is the fewest base62 characters that can hold every
+	// 32 bit checksum; 62^6 > 2^32 > 62^5.
+	minChecksumLength = 6
+)
+
+// Checksum is an algorithm used to calculate the 32 bit checksum of a token's
+// input.
+type Checksum interface {
+	// Name returns the name of the algorithm.
+	Name() string
+	// Sum32 returns the checksum of the given input.
+	Sum32(input string) uint32
+}
+
+// BytesChecksum is implemented by checksum algorithms that can calculate the
+// checksum of a byte slice w/o allocating; every built-in algorithm
+// implements it, and Schema.Sum32Bytes falls back to Sum32 for those that
+// don't.
+type BytesChecksum interface {
+	// Sum32Bytes returns the checksum of the given input.
+	Sum32Bytes(input []byte) uint32
+}
+
+// crc32IEEE is a Checksum backed by CRC32 w/ the IEEE polynomial.
+type crc32IEEE struct{}
+
+// Name returns the name of the algorithm.
+func (crc32IEEE) Name() string {
+	return "crc32-ieee"
+}
+
+// Sum32 returns the checksum of the given input.
+func (crc32IEEE) Sum32(input string) uint32 {
+	return datautil.GenerateCrc32Uint32(input)
+}
+
+// Sum32Bytes returns the checksum of the given input.
+func (crc32IEEE) Sum32Bytes(input []byte) uint32 {
+	return datautil.Crc32Uint32Bytes(input)
+}
+
+// crc32C is a Checksum backed by CRC32 w/ the Castagnoli polynomial.
+type crc32C struct{}
+
+// Name returns the name of the algorithm.
+func (crc32C) Name() string {
+	return "crc32c"
+}
+
+// Sum32 returns the checksum of the given input.
+func (crc32C) Sum32(input string) uint32 {
+	return datautil.GenerateCrc32cUint32(input)
+}
+
+// Sum32Bytes returns the checksum of the given input.
+func (crc32C) Sum32Bytes(input []byte) uint32 {
+	return datautil.Crc32cUint32Bytes(input)
+}
+
+// adler32Sum is a Checksum backed by Adler-32.
+type adler32Sum struct{}
+
+// Name returns the name of the algorithm.
+func (adler32Sum) Name() string {
+	return "adler32"
+}
+
+// Sum32 returns the checksum of the given input.
+func (adler32Sum) Sum32(input string) uint32 {
+	return adler32Of(input)
+}
+
+// Sum32Bytes returns the checksum of the given input.
+func (adler32Sum) Sum32Bytes(input []byte) uint32 {
+	return adler32.Checksum(input)
+}
+
+// Calculate the Adler-32 checksum of a string w/o converting it to the byte
+// slice hash/adler32 wants (which would allocate).
+func adler32Of(input string) uint32 {
+	const mod = 65521
+
+	a, b := uint32(1), uint32(0)
+	for i := 0; i < len(input); i++ {
+		a = (a + uint32(input[i])) % mod
+		b = (b + a) % mod
+	}
+
+	return b<<16 | a //nolint:gomnd
+}
+
+// fnv1a32 is a Checksum backed by 32 bit FNV-1a.
+type fnv1a32 struct{}
+
+// Name returns the name of the algorithm.
+func (fnv1a32) Name() string {
+	return "fnv1a-32"
+}
+
+// Sum32 returns the checksum of the given input.
+func (fnv1a32) Sum32(input string) uint32 {
+	return fnv1a(input)
+}
+
+// Sum32Bytes returns the checksum of the given input.
+func (fnv1a32) Sum32Bytes(input []byte) uint32 {
+	return fnv1a(input)
+}
+
+// Calculate the 32 bit FNV-1a hash of either a string or a byte slice; FNV-1a
+// is simple enough to inline, which avoids allocating a hash.Hash32.
+func fnv1a[T string | []byte](input T) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	h := uint32(offset32)
+	for i := 0; i < len(input); i++ {
+		h ^= uint32(input[i])
+		h *= prime32
+	}
+
+	return h
+}
+
+// Supported checksum algorithms; CRC32IEEE is the checksum algorithm used by
+// GitHub tokens.
+var (
+	CRC32IEEE Checksum = crc32IEEE{}
+	CRC32C    Checksum = crc32C{}
+	Adler32   Checksum = adler32Sum{}
+	FNV1a32   Checksum = fnv1a32{}
+)
+
+// Checksums returns every supported checksum algorithm.
+func Checksums() []Checksum {
+	return []Checksum{CRC32IEEE, CRC32C, Adler32, FNV1a32}
+}
+
+// LookupChecksum returns the supported checksum algorithm w/ the given name.
+func LookupChecksum(name string) (Checksum, bool) {
+	for _, c := range Checksums() {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// Schema describes a checksummed token format; the payload is made up of one
+// or more segments (separated by Sep), and the checksum occupies the last
+// characters of the final segment, encoded w/ the schema's alphabet.
+type Schema struct {
+	// Name is a unique, human friendly name of the schema.
+	Name string
+	// Prefix is the prefix of every token of the schema; it may contain Sep.
+	Prefix string
+	// Segments holds the length of each segment of the payload, in order.
+	Segments []int
+	// ChecksumLength is the number of characters the encoded checksum
+	// occupies at the end of the payload.
+	ChecksumLength int
+	// Alphabet is the ordered set of 62 symbols used to encode the payload.
+	Alphabet string
+	// Checksum is the algorithm used to calculate the checksum of the input.
+	Checksum Checksum
+	// UnverifiedChecksum marks schemas whose checksum layout is assumed,
+	// rather than documented; tokens of such schemas are generated w/ the
+	// assumed checksum, but only their structure (prefix, payload layout, and
+	// alphabet) is validated, so a wrong assumption can't hide real tokens.
+	UnverifiedChecksum bool
+}
+
+// PayloadLength returns the expected length of the payload, including the
+// separators between segments.
+func (s Schema) PayloadLength() int {
+	length := 0
+	for _, seg := range s.Segments {
+		length += seg
+	}
+
+	if len(s.Segments) > 1 {
+		length += (len(s.Segments) - 1) * len(Sep)
+	}
+
+	return length
+}
+
+// SepAt returns whether or not the separator belongs at the given index of a
+// payload, i.e. between two of the schema's segments.
+func (s Schema) SepAt(i int) bool {
+	if len(s.Segments) < 2 { //nolint:gomnd
+		return false
+	}
+
+	end := 0
+	for _, seg := range s.Segments[:len(s.Segments)-1] {
+		end += seg
+		if i == end {
+			return true
+		}
+		end += len(Sep)
+	}
+
+	return false
+}
+
+// InputLength returns the expected length of the payload without the
+// appended checksum.
+func (s Schema) InputLength() int {
+	return s.PayloadLength() - s.ChecksumLength
+}
+
+// Check returns an error if the schema is not usable, i.e. it is missing a
+// name, prefix, or checksum, it's payload layout doesn't leave room for the
+// checksum, or it's alphabet isn't made up of 62 distinct symbols.
+func (s Schema) Check() error {
+	switch {
+	case len(s.Name) < 1:
+		return fmt.Errorf("schema must have a name")
+	case len(s.Prefix) < 1:
+		return fmt.Errorf("schema '%s' must have a prefix", s.Name)
+	case s.Checksum == nil:
+		return fmt.Errorf("schema '%s' must have a checksum algorithm", s.Name)
+	case len(s.Segments) < 1:
+		return fmt.Errorf("schema '%s' must have at least one payload segment", s.Name)
+	case s.ChecksumLength < minChecksumLength:
+		return fmt.Errorf("schema '%s' must have a checksum length of at least %d", s.Name, minChecksumLength)
+	case s.Segments[len(s.Segments)-1] <= s.ChecksumLength:
+		return fmt.Errorf("schema '%s' must have a final segment longer than it's checksum", s.Name)
+	}
+
+	for i, seg := range s.Segments {
+		if seg < 1 {
+			return fmt.Errorf("schema '%s' has an empty payload segment at index %d", s.Name, i)
+		}
+	}
+
+	return checkAlphabet(s.Alphabet)
+}
+
+// checkAlphabet returns an error if the given alphabet isn't made up of 62
+// distinct, printable ASCII symbols that aren't the separator.
+func checkAlphabet(alphabet string) error {
+	if len(alphabet) != AlphabetSize {
+		return fmt.Errorf("alphabet '%s' must have %d symbols, not %d", alphabet, AlphabetSize, len(alphabet))
+	}
+
+	seen := make(map[byte]bool, AlphabetSize)
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		switch {
+		case c <= ' ' || c > '~':
+			return fmt.Errorf("alphabet '%s' has a non-printable symbol at index %d", alphabet, i)
+		case string(c) == Sep:
+			return fmt.Errorf("alphabet '%s' must not contain the separator '%s'", alphabet, Sep)
+		case seen[c]:
+			return fmt.Errorf("alphabet '%s' has a duplicate symbol '%c'", alphabet, c)
+		}
+		seen[c] = true
+	}
+
+	return nil
+}
+
+// Codecs of the well-known alphabets are shared; codecs of other alphabets
+// are built on first use, and cached by alphabet.
+var customCodecs sync.Map
+
+// Codec returns the base62 codec of the schema's alphabet; it panics if the
+// alphabet isn't usable, which Check guards against.
+func (s Schema) Codec() *base62.Codec {
+	switch s.Alphabet {
+	case GitHubAlphabet:
+		return base62.GitHub
+	case BigIntAlphabet:
+		return base62.BigInt
+	}
+
+	if c, found := customCodecs.Load(s.Alphabet); found {
+		return c.(*base62.Codec) //nolint:forcetypeassert
+	}
+
+	c, _ := customCodecs.LoadOrStore(s.Alphabet, base62.MustNewCodec(s.Alphabet))
+
+	return c.(*base62.Codec) //nolint:forcetypeassert
+}
+
+// InAlphabet returns whether or not the given byte is a symbol of the
+// schema's alphabet.
+func (s Schema) InAlphabet(c byte) bool {
+	return s.Codec().Valid(c)
+}
+
+// Encode encodes bytes into a base62 string using the schema's alphabet; the
+// result is not padded.
+func (s Schema) Encode(b []byte) string {
+	return s.Codec().Encode(b)
+}
+
+// EncodeWidth encodes bytes into a base62 string of exactly the given width
+// using the schema's alphabet; see base62.Codec.EncodeWidth.
+func (s Schema) EncodeWidth(b []byte, width int) (string, error) {
+	enc, err := s.Codec().EncodeWidth(b, width)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding w/ schema '%s': %w", s.Name, err)
+	}
+
+	return enc, nil
+}
+
+// Decode decodes a base62 string, encoded w/ the schema's alphabet, into a
+// byte slice of the given length; see base62.Codec.DecodeWidth, or
+// base62.Codec.Decode for lengths below 1.
+func (s Schema) Decode(enc string, length int) ([]byte, bool) {
+	if length < 1 {
+		b, err := s.Codec().Decode(enc)
+
+		return b, err == nil && len(enc) > 0
+	}
+
+	b, err := s.Codec().DecodeWidth(enc, length)
+	switch {
+	case errors.Is(err, base62.ErrOverflow):
+		return make([]byte, length), false
+	case err != nil || len(enc) < 1:
+		return nil, false
+	}
+
+	return b, true
+}
+
+// EncodeChecksum returns the checksum of the given input, encoded w/ the
+// schema's alphabet and padded to the schema's checksum length w/ the first
+// symbol of the alphabet, as it would appear at the end of a token's payload.
+func (s Schema) EncodeChecksum(input string) string {
+	buf := make([]byte, _32Bit)
+	binary.BigEndian.PutUint32(buf, s.Checksum.Sum32(input))
+	// Check guarantees the checksum length can hold any 32 bit value.
+	enc, _ := s.Codec().EncodeWidth(buf, s.ChecksumLength)
+
+	return enc
+}
+
+// DecodeChecksum decodes an encoded checksum, returning false if it is not a
+// 32 bit value encoded w/ the schema's alphabet.
+func (s Schema) DecodeChecksum(enc string) (uint32, bool) {
+	return s.Codec().DecodeUint32String(enc)
+}
+
+// DecodeChecksumBytes is DecodeChecksum for byte slices; it never allocates.
+func (s Schema) DecodeChecksumBytes(enc []byte) (uint32, bool) {
+	return s.Codec().DecodeUint32(enc)
+}
+
+// Sum32Bytes returns the checksum of the given input w/ the schema's checksum
+// algorithm; it only allocates if the algorithm isn't a BytesChecksum.
+func (s Schema) Sum32Bytes(input []byte) uint32 {
+	if c, ok := s.Checksum.(BytesChecksum); ok {
+		return c.Sum32Bytes(input)
+	}
+
+	return s.Checksum.Sum32(string(input))
+}
+
+// Pad left-pads the given encoded string to the given length w/ the first
+// symbol of the schema's alphabet (i.e. the encoded zero).
+func (s Schema) Pad(enc string, length int) string {
+	if len(enc) >= length {
+		return enc
+	}
+
+	return strings.Repeat(s.Alphabet[:1], length-len(enc)) + enc
+}